@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+type condVar interface {
+	Wait()
+	Signal()
+	Broadcast()
+}
+
+var benchImpls = []struct {
+	name    string
+	newCond func(l sync.Locker) condVar
+}{
+	{"cond", func(l sync.Locker) condVar { return New(l) }},
+	{"sync", func(l sync.Locker) condVar { return sync.NewCond(l) }},
+}
+
+var benchWaiters = []int{1, 4, 16, 64, 256, 1024}
+
+// BenchmarkSignal measures one Signal handing a token to one of n parked
+// consumers.
+func BenchmarkSignal(b *testing.B) {
+	for _, impl := range benchImpls {
+		for _, n := range benchWaiters {
+			b.Run(fmt.Sprintf("%s/waiters=%d", impl.name, n), func(b *testing.B) {
+				var mu sync.Mutex
+				c := impl.newCond(&mu)
+				tokens, done := 0, false
+
+				var wg sync.WaitGroup
+				for i := 0; i < n; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						mu.Lock()
+						defer mu.Unlock()
+						for {
+							for tokens == 0 && !done {
+								c.Wait()
+							}
+							if tokens == 0 {
+								return
+							}
+							tokens--
+						}
+					}()
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					mu.Lock()
+					tokens++
+					c.Signal()
+					mu.Unlock()
+				}
+
+				mu.Lock()
+				done = true
+				c.Broadcast()
+				mu.Unlock()
+				wg.Wait()
+			})
+		}
+	}
+}
+
+// BenchmarkBroadcast measures parking n waiters and releasing all of them with
+// a single Broadcast.
+func BenchmarkBroadcast(b *testing.B) {
+	for _, impl := range benchImpls {
+		for _, n := range benchWaiters {
+			b.Run(fmt.Sprintf("%s/waiters=%d", impl.name, n), func(b *testing.B) {
+				var mu sync.Mutex
+				c := impl.newCond(&mu)
+				gen, parked, rounds := 0, 0, b.N
+
+				var wg sync.WaitGroup
+				for i := 0; i < n; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						mu.Lock()
+						defer mu.Unlock()
+						for gen < rounds {
+							g := gen
+							parked++
+							for gen == g {
+								c.Wait()
+							}
+						}
+					}()
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < rounds; i++ {
+					mu.Lock()
+					for parked < n {
+						mu.Unlock()
+						runtime.Gosched()
+						mu.Lock()
+					}
+					parked = 0
+					gen++
+					c.Broadcast()
+					mu.Unlock()
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Feodosix/Go_examples/harness"
+)
+
+func TestNoLostSignal(t *testing.T) {
+	for _, policy := range []Policy{FIFO, LIFO, Priority} {
+		policy := policy
+		sc := harness.NoLostSignal(func(l harness.Locker) harness.Cond {
+			return NewWithPolicy(l, policy)
+		}, 4)
+		if err := harness.Explore(1, 100, sc); err != nil {
+			t.Errorf("policy %d: %v", policy, err)
+		}
+	}
+}
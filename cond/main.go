@@ -1,21 +1,68 @@
 package main
 
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
 type Locker interface {
 	Lock()
 	Unlock()
 }
 
+type Policy int
+
+const (
+	FIFO Policy = iota
+	LIFO
+	Priority
+)
+
+// A waiter passed over by this many signals is woken next regardless of policy.
+const maxSkips = 1 << 6
+
+var waitBuckets = [...]time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+type Stats struct {
+	Waiters     int
+	Signals     uint64
+	Broadcasts  uint64
+	LostSignals uint64
+	// WaitHistogram[i] counts waits no longer than waitBuckets[i]; the last
+	// bucket counts everything longer.
+	WaitHistogram [len(waitBuckets) + 1]uint64
+}
+
 type Cond struct {
 	L       Locker
-	waiters []chan struct{}
+	policy  Policy
+	waiters waitQueue
+	gen     uint64
+	// woken counts waiters released by Signal. A waiter has been passed over
+	// woken-stamp times, and the head of the queue is always the oldest one.
+	woken   uint64
+	changed chan struct{}
+	stats   Stats
+	debug   bool
 	lock    chan struct{}
 }
 
 func New(l Locker) *Cond {
+	return NewWithPolicy(l, FIFO)
+}
+
+func NewWithPolicy(l Locker, policy Policy) *Cond {
 	c := &Cond{
-		L:       l,
-		waiters: make([]chan struct{}, 0),
-		lock:    make(chan struct{}, 1),
+		L:      l,
+		policy: policy,
+		lock:   make(chan struct{}, 1),
 	}
 
 	c.lock <- struct{}{}
@@ -23,32 +70,214 @@ func New(l Locker) *Cond {
 }
 
 func (c *Cond) Wait() {
-	ch := make(chan struct{})
+	c.WaitPriority(0)
+}
+
+func (c *Cond) WaitPriority(p int) {
+	w := c.enqueue(p)
+
+	c.L.Unlock()
+	<-w.ch
+	c.observe(w)
+	putWaiter(w)
+	c.L.Lock()
+}
+
+func (c *Cond) WaitContext(ctx context.Context) error {
+	w := c.enqueue(0)
+
+	c.L.Unlock()
+	select {
+	case <-w.ch:
+		c.observe(w)
+		putWaiter(w)
+		c.L.Lock()
+		return nil
+	case <-ctx.Done():
+	}
 
 	<-c.lock
-	c.waiters = append(c.waiters, ch)
+	removed := c.waiters.remove(w)
 	c.lock <- struct{}{}
+	if !removed {
+		// Signal dequeued w before we got the queue lock, so its token is
+		// already buffered and the wakeup is ours.
+		<-w.ch
+	}
+	c.observe(w)
+	putWaiter(w)
 
-	c.L.Unlock()
-	<-ch
 	c.L.Lock()
+	if !removed {
+		return nil
+	}
+	return ctx.Err()
+}
+
+func (c *Cond) WaitUntil(pred func() bool) int {
+	wakeups := 0
+	for !pred() {
+		c.Wait()
+		wakeups++
+	}
+	return wakeups
+}
+
+func (c *Cond) WaitUntilContext(ctx context.Context, pred func() bool) (int, error) {
+	wakeups := 0
+	for !pred() {
+		if err := c.WaitContext(ctx); err != nil {
+			return wakeups, err
+		}
+		wakeups++
+	}
+	return wakeups, nil
+}
+
+func (c *Cond) enqueue(priority int) *waiter {
+	w := getWaiter(priority)
+
+	<-c.lock
+	if c.debug {
+		w.stack = debug.Stack()
+	}
+	w.stamp = c.woken
+	c.waiters.pushBack(w)
+	c.lock <- struct{}{}
+	return w
+}
+
+func (c *Cond) observe(w *waiter) {
+	d := time.Since(w.start)
+	bucket := len(waitBuckets)
+	for i, limit := range waitBuckets {
+		if d <= limit {
+			bucket = i
+			break
+		}
+	}
+
+	<-c.lock
+	c.stats.WaitHistogram[bucket]++
+	c.lock <- struct{}{}
+}
+
+func (c *Cond) next() *waiter {
+	if head := c.waiters.head; c.woken-head.stamp >= maxSkips {
+		return head
+	}
+
+	switch c.policy {
+	case LIFO:
+		return c.waiters.tail
+	case Priority:
+		best := c.waiters.head
+		for w := best.next; w != nil; w = w.next {
+			if w.priority > best.priority {
+				best = w
+			}
+		}
+		return best
+	default:
+		return c.waiters.head
+	}
+}
+
+func (c *Cond) signalOne() bool {
+	if c.waiters.len == 0 {
+		return false
+	}
+
+	waiter := c.next()
+	c.waiters.remove(waiter)
+	c.woken++
+	waiter.ch <- struct{}{}
+	return true
 }
 
 func (c *Cond) Signal() {
 	<-c.lock
-	if len(c.waiters) > 0 {
-		waiter := c.waiters[0]
-		c.waiters = c.waiters[1:]
-		close(waiter)
+	c.stats.Signals++
+	if !c.signalOne() {
+		c.stats.LostSignals++
 	}
 	c.lock <- struct{}{}
 }
 
+func (c *Cond) SignalN(n int) int {
+	<-c.lock
+	woken := 0
+	for woken < n && c.signalOne() {
+		woken++
+	}
+	if n > 0 {
+		c.stats.Signals += uint64(n)
+		c.stats.LostSignals += uint64(n - woken)
+	}
+	c.lock <- struct{}{}
+	return woken
+}
+
 func (c *Cond) Broadcast() {
 	<-c.lock
-	for _, waiter := range c.waiters {
-		close(waiter)
+	for c.waiters.head != nil {
+		waiter := c.waiters.head
+		c.waiters.remove(waiter)
+		waiter.ch <- struct{}{}
+	}
+	c.gen++
+	c.stats.Broadcasts++
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+	c.lock <- struct{}{}
+}
+
+// Changed returns a channel that is closed by the next Broadcast. Grab it while
+// holding L, before checking the condition, so that no broadcast can be missed.
+func (c *Cond) Changed() <-chan struct{} {
+	<-c.lock
+	if c.changed == nil {
+		// Made on demand so that Broadcast does not allocate for nobody.
+		c.changed = make(chan struct{})
+	}
+	ch := c.changed
+	c.lock <- struct{}{}
+	return ch
+}
+
+func (c *Cond) Generation() uint64 {
+	<-c.lock
+	gen := c.gen
+	c.lock <- struct{}{}
+	return gen
+}
+
+func (c *Cond) Stats() Stats {
+	<-c.lock
+	st := c.stats
+	st.Waiters = c.waiters.len
+	c.lock <- struct{}{}
+	return st
+}
+
+// SetDebug makes every subsequent waiter record the stack it was parked from,
+// see WaiterStacks.
+func (c *Cond) SetDebug(on bool) {
+	<-c.lock
+	c.debug = on
+	c.lock <- struct{}{}
+}
+
+func (c *Cond) WaiterStacks() []string {
+	<-c.lock
+	stacks := make([]string, 0, c.waiters.len)
+	for w := c.waiters.head; w != nil; w = w.next {
+		if w.stack != nil {
+			stacks = append(stacks, string(w.stack))
+		}
 	}
-	c.waiters = c.waiters[:0]
 	c.lock <- struct{}{}
+	return stacks
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForWaiters polls until n waiters are queued on c.
+func waitForWaiters(t *testing.T, c *Cond, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().Waiters != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d waiters queued, want %d", c.Stats().Waiters, n)
+		}
+		time.Sleep(time.Microsecond)
+	}
+}
+
+// TestWaitContextCancelRacesSignal cancels a waiter at the same time as a
+// Signal. The wakeup must go to exactly one waiter: either the cancelled one
+// returns nil because it took it, or it returns its error and the next waiter
+// is woken instead.
+func TestWaitContextCancelRacesSignal(t *testing.T) {
+	for i := 0; i < 500; i++ {
+		var mu sync.Mutex
+		c := New(&mu)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		first := make(chan error, 1)
+		go func() {
+			mu.Lock()
+			err := c.WaitContext(ctx)
+			mu.Unlock()
+			first <- err
+		}()
+		waitForWaiters(t, c, 1)
+
+		second := make(chan struct{})
+		go func() {
+			mu.Lock()
+			c.Wait()
+			mu.Unlock()
+			close(second)
+		}()
+		waitForWaiters(t, c, 2)
+
+		// Cancelling first wakes the waiter down its cancellation path, and
+		// the Signal right behind usually dequeues it before it gets there.
+		if i%2 == 0 {
+			cancel()
+			c.Signal()
+		} else {
+			go cancel()
+			c.Signal()
+		}
+
+		if err := <-first; err == nil {
+			// The cancelled waiter took the wakeup, so the second one must
+			// still be queued.
+			if n := c.Stats().Waiters; n != 1 {
+				t.Fatalf("iteration %d: signal consumed twice, %d waiters left", i, n)
+			}
+			c.Signal()
+		}
+		select {
+		case <-second:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("iteration %d: signal lost", i)
+		}
+		if st := c.Stats(); st.LostSignals != 0 || st.Waiters != 0 {
+			t.Fatalf("iteration %d: %d lost signals, %d waiters left", i, st.LostSignals, st.Waiters)
+		}
+	}
+}
+
+func TestWaitContextCancelled(t *testing.T) {
+	var mu sync.Mutex
+	c := New(&mu)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	mu.Lock()
+	err := c.WaitContext(ctx)
+	mu.Unlock()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("WaitContext returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := c.Stats().Waiters; n != 0 {
+		t.Fatalf("%d waiters left after cancellation", n)
+	}
+}
+
+func TestWaitUntilCountsWakeups(t *testing.T) {
+	var mu sync.Mutex
+	c := New(&mu)
+	n := 0
+
+	done := make(chan int)
+	go func() {
+		mu.Lock()
+		wakeups := c.WaitUntil(func() bool { return n == 3 })
+		mu.Unlock()
+		done <- wakeups
+	}()
+
+	for i := 0; i < 3; i++ {
+		waitForWaiters(t, c, 1)
+		mu.Lock()
+		n++
+		c.Signal()
+		mu.Unlock()
+	}
+	if wakeups := <-done; wakeups != 3 {
+		t.Fatalf("WaitUntil reported %d wakeups, want 3", wakeups)
+	}
+}
+
+func TestSignalN(t *testing.T) {
+	var mu sync.Mutex
+	c := New(&mu)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			c.Wait()
+			mu.Unlock()
+		}()
+	}
+	waitForWaiters(t, c, 5)
+
+	if woken := c.SignalN(3); woken != 3 {
+		t.Fatalf("SignalN(3) woke %d", woken)
+	}
+	if n := c.Stats().Waiters; n != 2 {
+		t.Fatalf("%d waiters left, want 2", n)
+	}
+	if woken := c.SignalN(5); woken != 2 {
+		t.Fatalf("SignalN(5) woke %d, want 2", woken)
+	}
+	wg.Wait()
+
+	st := c.Stats()
+	if st.Signals != 8 || st.LostSignals != 3 {
+		t.Fatalf("Signals %d, LostSignals %d, want 8 and 3", st.Signals, st.LostSignals)
+	}
+	var waits uint64
+	for _, n := range st.WaitHistogram {
+		waits += n
+	}
+	if waits != 5 {
+		t.Fatalf("wait histogram counts %d waits, want 5", waits)
+	}
+}
+
+func TestChangedAndGeneration(t *testing.T) {
+	var mu sync.Mutex
+	c := New(&mu)
+
+	ch := c.Changed()
+	gen := c.Generation()
+	select {
+	case <-ch:
+		t.Fatal("Changed closed before any Broadcast")
+	default:
+	}
+
+	c.Broadcast()
+	select {
+	case <-ch:
+	default:
+		t.Fatal("Broadcast did not close the Changed channel")
+	}
+	if g := c.Generation(); g != gen+1 {
+		t.Fatalf("generation %d, want %d", g, gen+1)
+	}
+
+	select {
+	case <-c.Changed():
+		t.Fatal("Changed after a Broadcast is already closed")
+	default:
+	}
+	if st := c.Stats(); st.Broadcasts != 1 {
+		t.Fatalf("%d broadcasts counted, want 1", st.Broadcasts)
+	}
+}
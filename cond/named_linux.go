@@ -0,0 +1,189 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// FileLocker is a Locker shared between processes through flock(2). The mutex
+// serialises goroutines of one process, since flock does not block between
+// users of the same open file.
+type FileLocker struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileLocker(path string) (*FileLocker, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLocker{f: f}, nil
+}
+
+// Lock panics if flock fails. Locker has no way to report an error, and flock
+// only fails for a closed or otherwise unusable descriptor.
+func (l *FileLocker) Lock() {
+	l.mu.Lock()
+	if err := flock(l.f, syscall.LOCK_EX); err != nil {
+		l.mu.Unlock()
+		panic("flock: " + err.Error())
+	}
+}
+
+// Unlock panics if flock fails, see Lock.
+func (l *FileLocker) Unlock() {
+	if err := flock(l.f, syscall.LOCK_UN); err != nil {
+		panic("flock: " + err.Error())
+	}
+	l.mu.Unlock()
+}
+
+func (l *FileLocker) Close() error {
+	return l.f.Close()
+}
+
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// NamedCond is a condition variable shared by every process that opens the same
+// directory. Each waiter binds a unixgram socket under dir/waiters, and
+// signalling sends one datagram to it. Socket names carry a sequence number
+// kept in dir/queue.lock and handed out under that lock, so Signal wakes
+// waiters in FIFO order. Keep dir short: socket paths are limited to 108
+// bytes.
+type NamedCond struct {
+	L *FileLocker
+
+	dir   string
+	queue *FileLocker
+}
+
+func Named(dir string) (*NamedCond, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "waiters"), 0o777); err != nil {
+		return nil, err
+	}
+
+	l, err := NewFileLocker(filepath.Join(dir, "lock"))
+	if err != nil {
+		return nil, err
+	}
+	queue, err := NewFileLocker(filepath.Join(dir, "queue.lock"))
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return &NamedCond{
+		L:     l,
+		dir:   dir,
+		queue: queue,
+	}, nil
+}
+
+func (c *NamedCond) Close() error {
+	err := c.L.Close()
+	if qerr := c.queue.Close(); err == nil {
+		err = qerr
+	}
+	return err
+}
+
+// Wait must be called with c.L held, like Cond.Wait, and returns with c.L held
+// in every case. An error from setting up the waiter socket means Wait never
+// parked or released c.L. An error from reading the wakeup means it parked and
+// released c.L, so the condition must be checked again, as after a wakeup.
+func (c *NamedCond) Wait() error {
+	c.queue.Lock()
+	seq, err := c.nextSeq()
+	if err != nil {
+		c.queue.Unlock()
+		return err
+	}
+	path := filepath.Join(c.dir, "waiters", fmt.Sprintf("%020d.sock", seq))
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	c.queue.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.L.Unlock()
+	_, err = conn.Read(make([]byte, 1))
+	conn.Close()
+	os.Remove(path)
+	c.L.Lock()
+	return err
+}
+
+// nextSeq bumps the counter stored in the queue lock file. c.queue must be held.
+func (c *NamedCond) nextSeq() (uint64, error) {
+	var buf [8]byte
+	if _, err := c.queue.f.ReadAt(buf[:], 0); err != nil && err != io.EOF {
+		return 0, err
+	}
+	seq := binary.LittleEndian.Uint64(buf[:]) + 1
+	binary.LittleEndian.PutUint64(buf[:], seq)
+	if _, err := c.queue.f.WriteAt(buf[:], 0); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+func (c *NamedCond) Signal() error {
+	return c.wake(1)
+}
+
+func (c *NamedCond) Broadcast() error {
+	return c.wake(-1)
+}
+
+func (c *NamedCond) wake(n int) error {
+	c.queue.Lock()
+	defer c.queue.Unlock()
+
+	waitersDir := filepath.Join(c.dir, "waiters")
+	entries, err := os.ReadDir(waitersDir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if n == 0 {
+			break
+		}
+		path := filepath.Join(waitersDir, e.Name())
+		// A waiter whose process died leaves a socket nobody reads from;
+		// notify fails on it and it is dropped without using up the wakeup.
+		err := notify(path)
+		os.Remove(path)
+		if err == nil {
+			n--
+		}
+	}
+	return nil
+}
+
+func notify(path string) error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte{1})
+	return err
+}
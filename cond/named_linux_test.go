@@ -0,0 +1,173 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// namedChildEnv makes the test binary act as a NamedCond waiter: it waits once
+// on the directory named by the variable and prints its index when woken.
+const namedChildEnv = "COND_NAMED_CHILD_DIR"
+
+func TestMain(m *testing.M) {
+	if dir := os.Getenv(namedChildEnv); dir != "" {
+		os.Exit(namedChild(dir))
+	}
+	os.Exit(m.Run())
+}
+
+func namedChild(dir string) int {
+	c, err := Named(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer c.Close()
+
+	c.L.Lock()
+	err = c.Wait()
+	c.L.Unlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(os.Getenv("COND_NAMED_CHILD_ID"))
+	return 0
+}
+
+type namedWaiter struct {
+	id   int
+	cmd  *exec.Cmd
+	woke chan int
+}
+
+// startWaiter runs a child process and returns once its socket is parked in dir.
+func startWaiter(t *testing.T, dir string, id int) *namedWaiter {
+	t.Helper()
+
+	parked := countWaiters(t, dir)
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), namedChildEnv+"="+dir, "COND_NAMED_CHILD_ID="+strconv.Itoa(id))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	w := &namedWaiter{id: id, cmd: cmd, woke: make(chan int, 1)}
+	go func() {
+		sc := bufio.NewScanner(out)
+		if sc.Scan() {
+			n, _ := strconv.Atoi(sc.Text())
+			w.woke <- n
+		}
+		close(w.woke)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for countWaiters(t, dir) == parked {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiter %d never parked", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return w
+}
+
+func countWaiters(t *testing.T, dir string) int {
+	entries, err := os.ReadDir(filepath.Join(dir, "waiters"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+// wokenWithin returns the ids of the waiters that report a wakeup within d.
+func wokenWithin(waiters []*namedWaiter, d time.Duration) []int {
+	var ids []int
+	timeout := time.After(d)
+	for _, w := range waiters {
+		select {
+		case id, ok := <-w.woke:
+			if ok {
+				ids = append(ids, id)
+			}
+		case <-timeout:
+			return ids
+		}
+	}
+	return ids
+}
+
+func TestNamedSignalWakesOneInOrder(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Named(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var waiters []*namedWaiter
+	for i := 0; i < 3; i++ {
+		waiters = append(waiters, startWaiter(t, dir, i))
+	}
+
+	for i := range waiters {
+		c.L.Lock()
+		err := c.Signal()
+		c.L.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := wokenWithin(waiters[i:i+1], 5*time.Second); len(got) != 1 || got[0] != i {
+			t.Fatalf("signal %d woke %v, want waiter %d", i, got, i)
+		}
+		if got := wokenWithin(waiters[i+1:], 200*time.Millisecond); len(got) != 0 {
+			t.Fatalf("signal %d also woke %v", i, got)
+		}
+	}
+}
+
+func TestNamedBroadcastWakesAll(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Named(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var waiters []*namedWaiter
+	for i := 0; i < 4; i++ {
+		waiters = append(waiters, startWaiter(t, dir, i))
+	}
+
+	c.L.Lock()
+	err = c.Broadcast()
+	c.L.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := wokenWithin(waiters, 5*time.Second); len(got) != len(waiters) {
+		t.Fatalf("broadcast woke %v, want all %d waiters", got, len(waiters))
+	}
+	if n := countWaiters(t, dir); n != 0 {
+		t.Fatalf("%d sockets left behind", n)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// waiter is a node of the intrusive wait queue. Nodes and their channels are
+// recycled through waiterPool, so the channel is buffered and a wakeup is a
+// single token rather than a close.
+type waiter struct {
+	ch       chan struct{}
+	priority int
+	stamp    uint64
+	start    time.Time
+	stack    []byte
+	queued   bool
+	prev     *waiter
+	next     *waiter
+}
+
+var waiterPool = sync.Pool{
+	New: func() interface{} {
+		return &waiter{ch: make(chan struct{}, 1)}
+	},
+}
+
+func getWaiter(priority int) *waiter {
+	w := waiterPool.Get().(*waiter)
+	w.priority = priority
+	w.start = time.Now()
+	w.stack = nil
+	return w
+}
+
+func putWaiter(w *waiter) {
+	w.stack = nil
+	waiterPool.Put(w)
+}
+
+type waitQueue struct {
+	head *waiter
+	tail *waiter
+	len  int
+}
+
+func (q *waitQueue) pushBack(w *waiter) {
+	w.prev, w.next = q.tail, nil
+	if q.tail != nil {
+		q.tail.next = w
+	} else {
+		q.head = w
+	}
+	q.tail = w
+	w.queued = true
+	q.len++
+}
+
+func (q *waitQueue) remove(w *waiter) bool {
+	if !w.queued {
+		return false
+	}
+
+	if w.prev != nil {
+		w.prev.next = w.next
+	} else {
+		q.head = w.next
+	}
+	if w.next != nil {
+		w.next.prev = w.prev
+	} else {
+		q.tail = w.prev
+	}
+	w.prev, w.next = nil, nil
+	w.queued = false
+	q.len--
+	return true
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/gif"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAnimatedSeconds = 10
+	maxAnimatedSeconds     = 120
+)
+
+// animatedHandler renders n seconds of ticking clock from ?start= as a looping
+// animated GIF.
+func animatedHandler(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	params, ok := clockParams(rw, q, "text cannot be animated")
+	if !ok {
+		return
+	}
+
+	start := timeNow()
+	if s := q.Get("start"); s != "" {
+		if !validTimeFormat(s) {
+			http.Error(rw, "invalid start", http.StatusBadRequest)
+			return
+		}
+		t, _ := time.Parse("15:04:05", s)
+		y, m, d := start.In(params.loc).Date()
+		start = time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, params.loc)
+	}
+
+	n := defaultAnimatedSeconds
+	if ns := q.Get("n"); ns != "" {
+		var err error
+		n, err = strconv.Atoi(ns)
+		if err != nil || n < 1 || n > maxAnimatedSeconds {
+			http.Error(rw, fmt.Sprintf("invalid n: want 1..%d", maxAnimatedSeconds), http.StatusBadRequest)
+			return
+		}
+	}
+
+	began := time.Now()
+	anim := &gif.GIF{}
+	for i := 0; i < n; i++ {
+		fr, err := params.frame(params.format(start.Add(time.Duration(i) * time.Second)))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		anim.Image = append(anim.Image, toPaletted(fr.rasterize(params.k)))
+		anim.Delay = append(anim.Delay, 100)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	metrics.observeRender("gif", time.Since(began))
+
+	rw.Header().Set("Content-Type", "image/gif")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(buf.Bytes())
+}
+
+// streamHandler pushes the current time as a new PNG or JPEG part of a
+// multipart/x-mixed-replace response every second until the client goes away.
+func streamHandler(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	params, ok := clockParams(rw, q, "text cannot be streamed")
+	if !ok {
+		return
+	}
+
+	name := q.Get("format")
+	if name == "" {
+		name = "jpeg"
+	}
+	format, err := formatByName(name)
+	if err != nil || (format.name != "png" && format.name != "jpeg") {
+		http.Error(rw, "invalid format: stream supports png and jpeg", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := startStream(rw)
+	if !ok {
+		return
+	}
+
+	mw := multipart.NewWriter(rw)
+	rw.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		began := time.Now()
+		fr, err := params.frame(params.format(began))
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := format.encode(&buf, fr, params.k); err != nil {
+			return
+		}
+		metrics.observeRender(format.name, time.Since(began))
+
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {format.contentType}})
+		if err != nil {
+			return
+		}
+		if _, err := part.Write(buf.Bytes()); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
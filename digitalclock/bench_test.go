@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"net/url"
+	"testing"
+)
+
+// rasterizeSet is the per-pixel img.Set rasteriser that rasterize replaced,
+// kept as the baseline for BenchmarkRasterize.
+func (f *frame) rasterizeSet(k int) *image.RGBA {
+	width, height := f.width*k, f.height*k
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, f.colors.bg)
+		}
+	}
+
+	f.eachLit(func(x, y int, fg color.NRGBA) {
+		for dy := 0; dy < k; dy++ {
+			for dx := 0; dx < k; dx++ {
+				img.Set(x*k+dx, y*k+dy, fg)
+			}
+		}
+	})
+	return img
+}
+
+func BenchmarkRasterize(b *testing.B) {
+	font, err := fonts.Lookup("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	colors, err := parseColorParams(url.Values{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	fr, err := newFrame(font, "12:34:56", colors)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	paths := []struct {
+		name string
+		fn   func(k int) *image.RGBA
+	}{
+		{"set", fr.rasterizeSet},
+		{"tile", fr.rasterize},
+	}
+	for _, k := range []int{1, 10, 30} {
+		for _, p := range paths {
+			b.Run(fmt.Sprintf("k=%d/%s", k, p.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					p.fn(k)
+				}
+			})
+		}
+	}
+}
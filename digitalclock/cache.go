@@ -0,0 +1,59 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+type cachedImage struct {
+	key         string
+	body        []byte
+	etag        string
+	contentType string
+}
+
+// imageCache is an LRU of encoded responses.
+type imageCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newImageCache(size int) *imageCache {
+	return &imageCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *imageCache) Get(key string) (*cachedImage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cachedImage), true
+}
+
+func (c *imageCache) Add(img *cachedImage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[img.key]; ok {
+		el.Value = img
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[img.key] = c.order.PushFront(img)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cachedImage).key)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var namedColors = map[string]color.NRGBA{
+	"black":       {0, 0, 0, 255},
+	"white":       {255, 255, 255, 255},
+	"red":         {255, 0, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"lime":        {0, 255, 0, 255},
+	"blue":        {0, 0, 255, 255},
+	"yellow":      {255, 255, 0, 255},
+	"cyan":        {0, 255, 255, 255},
+	"magenta":     {255, 0, 255, 255},
+	"orange":      {255, 165, 0, 255},
+	"purple":      {128, 0, 128, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"transparent": {0, 0, 0, 0},
+}
+
+// parseColor accepts a colour name, hex in #rgb, #rrggbb or #rrggbbaa form
+// (the '#' may be left out, since it has to be escaped in a query), or
+// rgba(r,g,b,a) with a in [0,1].
+func parseColor(s string) (color.NRGBA, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[s]; ok {
+		return c, nil
+	}
+	if strings.HasPrefix(s, "rgba(") || strings.HasPrefix(s, "rgb(") {
+		return parseRGBA(s)
+	}
+	return parseHex(strings.TrimPrefix(s, "#"))
+}
+
+func parseHex(orig string) (color.NRGBA, error) {
+	s := orig
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return color.NRGBA{}, fmt.Errorf("unknown colour %q", orig)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("bad hex colour %q", orig)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func parseRGBA(s string) (color.NRGBA, error) {
+	open := strings.IndexByte(s, '(')
+	if !strings.HasSuffix(s, ")") {
+		return color.NRGBA{}, fmt.Errorf("bad colour %q", s)
+	}
+	parts := strings.Split(s[open+1:len(s)-1], ",")
+	if len(parts) != 3 && len(parts) != 4 {
+		return color.NRGBA{}, fmt.Errorf("bad colour %q: want 3 or 4 components", s)
+	}
+
+	var rgb [3]uint8
+	for i := range rgb {
+		v, err := strconv.Atoi(strings.TrimSpace(parts[i]))
+		if err != nil || v < 0 || v > 255 {
+			return color.NRGBA{}, fmt.Errorf("bad colour %q: component %d out of range", s, i+1)
+		}
+		rgb[i] = uint8(v)
+	}
+
+	a := 1.0
+	if len(parts) == 4 {
+		var err error
+		a, err = strconv.ParseFloat(strings.TrimSpace(parts[3]), 64)
+		if err != nil || a < 0 || a > 1 {
+			return color.NRGBA{}, fmt.Errorf("bad colour %q: alpha must be in [0,1]", s)
+		}
+	}
+	return color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: uint8(a*255 + 0.5)}, nil
+}
+
+// splitColors splits a comma-separated colour list, leaving the commas inside
+// rgba(...) alone.
+func splitColors(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
+
+type colorParams struct {
+	fg, bg  color.NRGBA
+	palette []color.NRGBA
+	// gradient interpolates between the first and last palette entries
+	// instead of cycling through them.
+	gradient bool
+}
+
+func parseColorParams(q url.Values) (colorParams, error) {
+	p := colorParams{
+		fg: color.NRGBA{R: Cyan.R, G: Cyan.G, B: Cyan.B, A: Cyan.A},
+		bg: color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+	}
+
+	var err error
+	if s := q.Get("fg"); s != "" {
+		if p.fg, err = parseColor(s); err != nil {
+			return p, fmt.Errorf("invalid fg: %w", err)
+		}
+	}
+	if s := q.Get("bg"); s != "" {
+		if p.bg, err = parseColor(s); err != nil {
+			return p, fmt.Errorf("invalid bg: %w", err)
+		}
+	}
+
+	palette, gradient := q.Get("palette"), q.Get("gradient")
+	if palette != "" && gradient != "" {
+		return p, fmt.Errorf("invalid gradient: palette and gradient are mutually exclusive")
+	}
+	param, list := "palette", palette
+	if gradient != "" {
+		param, list, p.gradient = "gradient", gradient, true
+	}
+	if list == "" {
+		return p, nil
+	}
+
+	for _, s := range splitColors(list) {
+		c, err := parseColor(s)
+		if err != nil {
+			return p, fmt.Errorf("invalid %s: %w", param, err)
+		}
+		p.palette = append(p.palette, c)
+	}
+	if p.gradient && len(p.palette) != 2 {
+		return p, fmt.Errorf("invalid gradient: want exactly two colours")
+	}
+	return p, nil
+}
+
+// glyphColor returns the colour of the i-th of n glyphs.
+func (p colorParams) glyphColor(i, n int) color.NRGBA {
+	switch {
+	case len(p.palette) == 0:
+		return p.fg
+	case !p.gradient:
+		return p.palette[i%len(p.palette)]
+	case n < 2:
+		return p.palette[0]
+	}
+
+	from, to := p.palette[0], p.palette[1]
+	lerp := func(a, b uint8) uint8 {
+		return uint8((int(a)*(n-1-i) + int(b)*i) / (n - 1))
+	}
+	return color.NRGBA{R: lerp(from.R, to.R), G: lerp(from.G, to.G), B: lerp(from.B, to.B), A: lerp(from.A, to.A)}
+}
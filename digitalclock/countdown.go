@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// countdownHandler renders the time left until ?until=, stopping at zero.
+func countdownHandler(rw http.ResponseWriter, r *http.Request) {
+	durationHandler(rw, r, "until", func(t time.Time) time.Duration {
+		return t.Sub(timeNow())
+	})
+}
+
+// elapsedHandler renders the time passed since ?since=.
+func elapsedHandler(rw http.ResponseWriter, r *http.Request) {
+	durationHandler(rw, r, "since", func(t time.Time) time.Duration {
+		return timeNow().Sub(t)
+	})
+}
+
+func durationHandler(rw http.ResponseWriter, r *http.Request, param string, span func(time.Time) time.Duration) {
+	q := r.URL.Query()
+
+	params, ok := clockParams(rw, q, "text has no span to count")
+	if !ok {
+		return
+	}
+
+	ts := q.Get(param)
+	if ts == "" {
+		http.Error(rw, fmt.Sprintf("invalid %s: missing", param), http.StatusBadRequest)
+		return
+	}
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("invalid %s: want RFC 3339", param), http.StatusBadRequest)
+		return
+	}
+
+	fr, err := params.frame(formatSpan(span(t)))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Get("blink") != "" && timeNow().Second()%2 == 1 {
+		fr.hide(':')
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	serveFrame(rw, r, fr, params.k)
+}
+
+// formatSpan prints d as HH:MM:SS, prefixed with "ND " once it exceeds a day.
+// Negative spans print as zero.
+func formatSpan(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	secs := int64(d / time.Second)
+	days, secs := secs/86400, secs%86400
+	hms := fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs%3600/60, secs%60)
+	if days == 0 {
+		return hms
+	}
+	return fmt.Sprintf("%dD %s", days, hms)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const sseHeartbeat = 15 * time.Second
+
+type clockEvent struct {
+	Time     string `json:"time"`
+	TimeZone string `json:"tz"`
+	URL      string `json:"url,omitempty"`
+	PNG      string `json:"png,omitempty"`
+}
+
+// eventsHandler sends a Server-Sent Event with the current time every second.
+// The payload links to the matching frame, or carries it as base64 PNG when
+// ?inline= is set. Comment heartbeats keep idle proxies from closing the
+// connection.
+func eventsHandler(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	params, ok := clockParams(rw, q, "text has no clock events")
+	if !ok {
+		return
+	}
+	inline := q.Get("inline") != ""
+
+	flusher, ok := startStream(rw)
+	if !ok {
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	frameQuery := r.URL.Query()
+	frameQuery.Del("inline")
+
+	for id := 1; ; id++ {
+		now := params.format(timeNow())
+		ev := clockEvent{Time: now, TimeZone: params.loc.String()}
+		if inline {
+			fr, err := params.frame(now)
+			if err != nil {
+				return
+			}
+			began := time.Now()
+			var buf bytes.Buffer
+			if err := encodePNG(&buf, fr, params.k); err != nil {
+				return
+			}
+			metrics.observeRender("png", time.Since(began))
+			ev.PNG = base64.StdEncoding.EncodeToString(buf.Bytes())
+		} else {
+			frameQuery.Set("time", now)
+			ev.URL = "/?" + frameQuery.Encode()
+		}
+
+		var data bytes.Buffer
+		enc := json.NewEncoder(&data)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+		// Encode ends with a newline, which terminates the data line.
+		if _, err := fmt.Fprintf(rw, "id: %d\nevent: tick\ndata: %s\n", id, data.Bytes()); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		for waiting := true; waiting; {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(rw, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-ticker.C:
+				waiting = false
+			}
+		}
+	}
+}
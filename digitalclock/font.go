@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Glyph is a bitmap stored row by row; '.' is an unlit pixel and anything else
+// is lit.
+type Glyph struct {
+	Rows []string
+}
+
+func glyphFromString(s string) Glyph {
+	return Glyph{Rows: strings.Split(s, "\n")}
+}
+
+func (g Glyph) Width() int {
+	if len(g.Rows) == 0 {
+		return 0
+	}
+	return len(g.Rows[0])
+}
+
+func (g Glyph) Height() int {
+	return len(g.Rows)
+}
+
+type Font struct {
+	Name   string
+	Height int
+	glyphs map[rune]Glyph
+}
+
+func (f *Font) Glyph(ch rune) (Glyph, error) {
+	g, ok := f.glyphs[ch]
+	if !ok {
+		return Glyph{}, fmt.Errorf("font %q has no glyph for %q", f.Name, ch)
+	}
+	return g, nil
+}
+
+type FontRegistry struct {
+	mu    sync.RWMutex
+	fonts map[string]*Font
+}
+
+func NewFontRegistry() *FontRegistry {
+	r := &FontRegistry{fonts: make(map[string]*Font)}
+	r.Register(defaultFont())
+	return r
+}
+
+func (r *FontRegistry) Register(f *Font) {
+	r.mu.Lock()
+	r.fonts[f.Name] = f
+	r.mu.Unlock()
+}
+
+// Lookup returns the named font, or the built-in one when name is empty.
+func (r *FontRegistry) Lookup(name string) (*Font, error) {
+	if name == "" {
+		name = "default"
+	}
+
+	r.mu.RLock()
+	f, ok := r.fonts[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown font %q", name)
+	}
+	return f, nil
+}
+
+// LoadDir registers every *.bdf and *.txt font in dir under its file name
+// without the extension.
+func (r *FontRegistry) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		var parse func(string, io.Reader) (*Font, error)
+		switch ext {
+		case ".bdf":
+			parse = ParseBDF
+		case ".txt":
+			parse = ParseDotMatrix
+		default:
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		font, err := parse(strings.TrimSuffix(e.Name(), ext), f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		r.Register(font)
+	}
+	return nil
+}
+
+// ParseDotMatrix reads the plain text font format: a line "= c" starts the
+// glyph for character c, which may be a space, and is followed by its rows,
+// using '.' for unlit pixels. Blank lines and lines starting with '#' outside a glyph are skipped.
+func ParseDotMatrix(name string, r io.Reader) (*Font, error) {
+	f := &Font{Name: name, glyphs: make(map[rune]Glyph)}
+
+	var (
+		cur   rune
+		rows  []string
+		open  bool
+		lineN int
+	)
+	flush := func() error {
+		if !open {
+			return nil
+		}
+		if len(rows) == 0 {
+			return fmt.Errorf("glyph %q is empty", cur)
+		}
+		for _, row := range rows {
+			if len(row) != len(rows[0]) {
+				return fmt.Errorf("glyph %q has rows of different width", cur)
+			}
+		}
+		if f.Height != 0 && len(rows) != f.Height {
+			return fmt.Errorf("glyph %q is %d rows high, want %d", cur, len(rows), f.Height)
+		}
+		f.Height = len(rows)
+		f.glyphs[cur] = Glyph{Rows: rows}
+		rows, open = nil, false
+		return nil
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineN++
+		raw := strings.TrimRight(sc.Text(), "\r")
+		line := strings.TrimRight(raw, " \t")
+		switch {
+		case strings.HasPrefix(raw, "= "):
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			// The header is matched before trimming, since the character
+			// may itself be a space.
+			chars := []rune(raw[2:])
+			if len(chars) == 0 || strings.TrimSpace(string(chars[1:])) != "" {
+				return nil, fmt.Errorf("line %d: want exactly one character after '='", lineN)
+			}
+			cur, open = chars[0], true
+		case line == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case !open && strings.HasPrefix(line, "#"):
+		case !open:
+			return nil, fmt.Errorf("line %d: pixel row outside a glyph", lineN)
+		default:
+			rows = append(rows, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(f.glyphs) == 0 {
+		return nil, fmt.Errorf("no glyphs")
+	}
+	return f, nil
+}
+
+// ParseBDF reads an X11 BDF font. Glyphs are placed on the font bounding box
+// baseline, so every glyph has the same height.
+func ParseBDF(name string, r io.Reader) (*Font, error) {
+	f := &Font{Name: name, glyphs: make(map[rune]Glyph)}
+
+	var (
+		fontW, fontAscent  int
+		enc                = -1
+		dwidth             int
+		bbW, bbH, bbX, bbY int
+		bitmap             []string
+		inBitmap           bool
+	)
+
+	ints := func(fields []string, n int) ([]int, error) {
+		if len(fields) < n+1 {
+			return nil, fmt.Errorf("%s: want %d values", fields[0], n)
+		}
+		out := make([]int, n)
+		for i := range out {
+			v, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fields[0], err)
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if inBitmap && fields[0] != "ENDCHAR" {
+			bitmap = append(bitmap, fields[0])
+			continue
+		}
+
+		switch fields[0] {
+		case "FONTBOUNDINGBOX":
+			v, err := ints(fields, 4)
+			if err != nil {
+				return nil, err
+			}
+			fontW, f.Height, fontAscent = v[0], v[1], v[1]+v[3]
+		case "STARTCHAR":
+			enc, dwidth, bitmap = -1, 0, nil
+		case "ENCODING":
+			v, err := ints(fields, 1)
+			if err != nil {
+				return nil, err
+			}
+			enc = v[0]
+		case "DWIDTH":
+			v, err := ints(fields, 2)
+			if err != nil {
+				return nil, err
+			}
+			dwidth = v[0]
+		case "BBX":
+			v, err := ints(fields, 4)
+			if err != nil {
+				return nil, err
+			}
+			bbW, bbH, bbX, bbY = v[0], v[1], v[2], v[3]
+		case "BITMAP":
+			inBitmap = true
+		case "ENDCHAR":
+			inBitmap = false
+			if enc < 0 {
+				continue
+			}
+			if f.Height == 0 {
+				return nil, fmt.Errorf("glyph %d before FONTBOUNDINGBOX", enc)
+			}
+			w := dwidth
+			if w == 0 {
+				w = fontW
+			}
+			g, err := bdfGlyph(bitmap, w, f.Height, bbW, bbH, bbX, fontAscent-bbH-bbY)
+			if err != nil {
+				return nil, fmt.Errorf("glyph %d: %w", enc, err)
+			}
+			f.glyphs[rune(enc)] = g
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(f.glyphs) == 0 {
+		return nil, fmt.Errorf("no glyphs")
+	}
+	return f, nil
+}
+
+func bdfGlyph(bitmap []string, w, h, bbW, bbH, offX, offY int) (Glyph, error) {
+	cells := make([][]byte, h)
+	for y := range cells {
+		cells[y] = []byte(strings.Repeat(".", w))
+	}
+
+	for y, hex := range bitmap {
+		if y >= bbH {
+			break
+		}
+		bits, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return Glyph{}, err
+		}
+		for x := 0; x < bbW && x < len(hex)*4; x++ {
+			if bits&(1<<uint(len(hex)*4-1-x)) == 0 {
+				continue
+			}
+			px, py := offX+x, offY+y
+			if px >= 0 && px < w && py >= 0 && py < h {
+				cells[py][px] = '#'
+			}
+		}
+	}
+
+	rows := make([]string, h)
+	for y, row := range cells {
+		rows[y] = string(row)
+	}
+	return Glyph{Rows: rows}, nil
+}
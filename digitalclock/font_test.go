@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotMatrix(t *testing.T) {
+	src := "# test font\r\n" +
+		"= 1 \r\n" +
+		".#\r\n" +
+		"##\r\n" +
+		".#\r\n" +
+		"\r\n" +
+		"=  \r\n" +
+		"..\r\n" +
+		"..\r\n" +
+		"..\r\n"
+
+	f, err := ParseDotMatrix("test", strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Height != 3 {
+		t.Errorf("height %d, want 3", f.Height)
+	}
+
+	for ch, want := range map[rune][]string{
+		'1': {".#", "##", ".#"},
+		' ': {"..", "..", ".."},
+	} {
+		g, err := f.Glyph(ch)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(g.Rows, want) {
+			t.Errorf("glyph %q: rows %q, want %q", ch, g.Rows, want)
+		}
+	}
+
+	// A space glyph is what lets .txt fonts draw 12h times and long spans.
+	if _, err := layoutText(f, "1 1", 0, colorParams{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseDotMatrixErrors(t *testing.T) {
+	for _, src := range []string{
+		"=\n#\n",
+		"= 12\n#\n",
+		"#\n= 1\n",
+		"= 1\n#\n\n.#\n",
+		"= 1\n#.\n#\n",
+		"= 1\n#\n= 2\n#\n#\n",
+		"# only a comment\n",
+	} {
+		if _, err := ParseDotMatrix("test", strings.NewReader(src)); err == nil {
+			t.Errorf("%q: no error", src)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type outputFormat struct {
+	name        string
+	contentType string
+	encode      func(w io.Writer, f *frame, k int) error
+}
+
+var outputFormats = []outputFormat{
+	{"png", "image/png", encodePNG},
+	{"svg", "image/svg+xml", encodeSVG},
+	{"gif", "image/gif", encodeGIF},
+	{"jpeg", "image/jpeg", encodeJPEG},
+	{"txt", "text/plain; charset=utf-8", encodeText},
+}
+
+// negotiateFormat picks the format from ?format=, then from the Accept header,
+// and falls back to PNG. Each format gets the q of the most specific range
+// matching it, and formats the client rates equally go in outputFormats order.
+func negotiateFormat(r *http.Request) (outputFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		return formatByName(name)
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return outputFormats[0], nil
+	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+
+	best, bestQ := -1, 0.0
+	for i, f := range outputFormats {
+		if q := acceptQuality(ranges, f.contentType); q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	if best < 0 {
+		return outputFormat{}, errNotAcceptable
+	}
+	return outputFormats[best], nil
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// acceptQuality returns the q of the most specific range matching
+// contentType: an exact type beats type/*, which beats */*. It is zero when
+// nothing matches.
+func acceptQuality(ranges []acceptRange, contentType string) float64 {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch r.mediaType {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+func formatByName(name string) (outputFormat, error) {
+	if name == "jpg" {
+		name = "jpeg"
+	}
+	for _, f := range outputFormats {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return outputFormat{}, fmt.Errorf("invalid format %q", name)
+}
+
+var errNotAcceptable = fmt.Errorf("none of the accepted types can be produced")
+
+func encodePNG(w io.Writer, f *frame, k int) error {
+	return png.Encode(w, f.rasterize(k))
+}
+
+// encodeSVG draws one rectangle per lit font pixel in a viewBox measured in
+// font pixels, so the image scales without re-rendering.
+func encodeSVG(w io.Writer, f *frame, k int) error {
+	scale := f.pixelScale(k)
+	rendering := "crispEdges"
+	if f.shapes != nil {
+		rendering = "geometricPrecision"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %d %d" shape-rendering="%s">`+"\n",
+		float64(f.width)*scale, float64(f.height)*scale, f.width, f.height, rendering)
+	if f.colors.bg.A != 0 {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%" %s/>`+"\n", svgFill(f.colors.bg))
+	}
+	if f.shapes != nil {
+		for _, s := range f.visibleShapes() {
+			if s.poly == nil {
+				fmt.Fprintf(bw, `<circle cx="%g" cy="%g" r="%g" %s/>`+"\n", s.cx, s.cy, s.r, svgFill(s.color))
+				continue
+			}
+			fmt.Fprint(bw, `<polygon points="`)
+			for i, p := range s.poly {
+				if i > 0 {
+					fmt.Fprint(bw, " ")
+				}
+				fmt.Fprintf(bw, "%g,%g", p.x, p.y)
+			}
+			fmt.Fprintf(bw, `" %s/>`+"\n", svgFill(s.color))
+		}
+		fmt.Fprintln(bw, "</svg>")
+		return bw.Flush()
+	}
+	f.eachLit(func(x, y int, c color.NRGBA) {
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="1" height="1" %s/>`+"\n", x, y, svgFill(c))
+	})
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+func svgFill(c color.NRGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	}
+	return fmt.Sprintf(`fill="#%02x%02x%02x" fill-opacity="%.3f"`, c.R, c.G, c.B, float64(c.A)/255)
+}
+
+func encodeGIF(w io.Writer, f *frame, k int) error {
+	return gif.Encode(w, toPaletted(f.rasterize(k)), nil)
+}
+
+// toPaletted converts img using exactly the colours it contains, which keeps
+// transparency and avoids dithering. Images with more than 256 colours fall
+// back to the Plan 9 palette.
+func toPaletted(img *image.RGBA) *image.Paletted {
+	var pal color.Palette
+	index := make(map[color.RGBA]uint8)
+	b := img.Bounds()
+	exact := true
+	for y := b.Min.Y; y < b.Max.Y && exact; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if _, ok := index[c]; ok {
+				continue
+			}
+			if len(pal) == 256 {
+				exact = false
+				break
+			}
+			index[c] = uint8(len(pal))
+			pal = append(pal, c)
+		}
+	}
+
+	if !exact {
+		pm := image.NewPaletted(b, palette.Plan9)
+		draw.FloydSteinberg.Draw(pm, b, img, b.Min)
+		return pm
+	}
+
+	pm := image.NewPaletted(b, pal)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			pm.SetColorIndex(x, y, index[img.RGBAAt(x, y)])
+		}
+	}
+	return pm
+}
+
+func encodeJPEG(w io.Writer, f *frame, k int) error {
+	// JPEG has no alpha, so flatten onto white like a browser would.
+	img := f.rasterize(k)
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, image.Point{}, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: 90})
+}
+
+// encodeText prints the frame as ASCII art, k characters per font pixel.
+func encodeText(w io.Writer, f *frame, k int) error {
+	grid := make([][]byte, f.height)
+	for y := range grid {
+		grid[y] = []byte(strings.Repeat(" ", f.width))
+	}
+	f.eachLit(func(x, y int, _ color.NRGBA) {
+		grid[y][x] = '#'
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, row := range grid {
+		var line strings.Builder
+		for _, ch := range row {
+			line.WriteString(strings.Repeat(string(ch), k))
+		}
+		for i := 0; i < k; i++ {
+			fmt.Fprintln(bw, strings.TrimRight(line.String(), " "))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   string
+	}{
+		{"", "png"},
+		// Chrome's image Accept rates svg and image/* equally.
+		{"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", "png"},
+		{"image/svg+xml", "svg"},
+		{"image/gif;q=0.5, image/jpeg", "jpeg"},
+		{"text/*", "txt"},
+		{"image/*, image/png;q=0", "svg"},
+		{"text/html, */*;q=0.1", "png"},
+		{"image/p", ""},
+		{"text/html", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tc.accept)
+		f, err := negotiateFormat(r)
+		if tc.want == "" {
+			if err != errNotAcceptable {
+				t.Errorf("Accept %q: got %q, %v, want %v", tc.accept, f.name, err, errNotAcceptable)
+			}
+			continue
+		}
+		if err != nil || f.name != tc.want {
+			t.Errorf("Accept %q: got %q, %v, want %q", tc.accept, f.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import "image/color"
+
+var Cyan = color.RGBA{R: 0, G: 255, B: 255, A: 255}
+
+const Zero = `.###..
+#...#.
+#..##.
+#.#.#.
+##..#.
+#...#.
+.###..`
+
+const One = `..#...
+.##...
+..#...
+..#...
+..#...
+..#...
+.###..`
+
+const Two = `.###..
+#...#.
+....#.
+..##..
+.#....
+#.....
+#####.`
+
+const Three = `.###..
+#...#.
+....#.
+..##..
+....#.
+#...#.
+.###..`
+
+const Four = `...#..
+..##..
+.#.#..
+#..#..
+#####.
+...#..
+...#..`
+
+const Five = `#####.
+#.....
+####..
+....#.
+....#.
+#...#.
+.###..`
+
+const Six = `..##..
+.#....
+#.....
+####..
+#...#.
+#...#.
+.###..`
+
+const Seven = `#####.
+....#.
+...#..
+..#...
+.#....
+.#....
+.#....`
+
+const Eight = `.###..
+#...#.
+#...#.
+.###..
+#...#.
+#...#.
+.###..`
+
+const Nine = `.###..
+#...#.
+#...#.
+.####.
+....#.
+...#..
+.##...`
+
+const Colon = `...
+...
+.#.
+...
+.#.
+...
+...`
+
+const LetterA = `.###..
+#...#.
+#...#.
+#####.
+#...#.
+#...#.
+#...#.`
+
+const LetterP = `####..
+#...#.
+#...#.
+####..
+#.....
+#.....
+#.....`
+
+const LetterD = `####..
+#...#.
+#...#.
+#...#.
+#...#.
+#...#.
+####..`
+
+const LetterM = `#...#.
+##.##.
+#.#.#.
+#.#.#.
+#...#.
+#...#.
+#...#.`
+
+const Dash = `....
+....
+....
+###.
+....
+....
+....`
+
+const Space = `..
+..
+..
+..
+..
+..
+..`
+
+func defaultFont() *Font {
+	f := &Font{
+		Name:   "default",
+		Height: 7,
+		glyphs: make(map[rune]Glyph),
+	}
+	for ch, sym := range map[rune]string{
+		'0': Zero, '1': One, '2': Two, '3': Three, '4': Four,
+		'5': Five, '6': Six, '7': Seven, '8': Eight, '9': Nine,
+		':': Colon, '-': Dash, ' ': Space,
+		'A': LetterA, 'D': LetterD, 'P': LetterP, 'M': LetterM,
+	} {
+		f.glyphs[ch] = glyphFromString(sym)
+	}
+	return f
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the files in testdata/golden instead of comparing against them")
+
+const goldenDir = "testdata/golden"
+
+// goldenNow is the clock pinned for endpoints that draw the current time.
+var goldenNow = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type goldenCase struct {
+	name    string
+	handler http.HandlerFunc
+	query   string
+	// tolerance is the largest per-channel difference still counted as equal;
+	// zero means an exact match.
+	tolerance int
+}
+
+func goldenCases() []goldenCase {
+	var cases []goldenCase
+	for _, t := range []string{"00:00:00", "12:34:56"} {
+		for _, k := range []int{1, 4} {
+			for _, c := range []struct{ name, query string }{
+				{"default", ""},
+				{"redclear", "&fg=red&bg=transparent"},
+			} {
+				for _, format := range []string{"png", "gif", "jpeg", "svg", "txt"} {
+					tc := goldenCase{
+						name:    fmt.Sprintf("%s_k%d_%s.%s", strings.ReplaceAll(t, ":", ""), k, c.name, format),
+						handler: clockHandler,
+						query:   fmt.Sprintf("time=%s&k=%d&format=%s%s", t, k, format, c.query),
+					}
+					if format == "jpeg" {
+						tc.tolerance = 12
+					}
+					cases = append(cases, tc)
+				}
+			}
+		}
+	}
+
+	modes := []struct{ name, query string }{
+		{"24h", "time=12:34:56"},
+		{"12h", "mode=12h&time=01:02:03 PM"},
+		{"date", "mode=date&time=2026-10-18"},
+	}
+	for _, style := range []string{"bitmap", "segment", "dots"} {
+		for _, m := range modes {
+			for _, format := range []string{"png", "svg"} {
+				cases = append(cases, goldenCase{
+					name:    fmt.Sprintf("%s_%s.%s", style, m.name, format),
+					handler: clockHandler,
+					query:   fmt.Sprintf("%s&style=%s&k=4&format=%s", m.query, style, format),
+				})
+			}
+		}
+	}
+	for _, style := range []string{"segment", "dots"} {
+		cases = append(cases, goldenCase{
+			name:    fmt.Sprintf("%s_scale2.5.png", style),
+			handler: clockHandler,
+			query:   "time=12:34:56&scale=2.5&format=png&style=" + style,
+		})
+	}
+
+	for _, style := range []string{"bitmap", "segment", "dots"} {
+		cases = append(cases,
+			goldenCase{
+				name:    fmt.Sprintf("countdown_%s.png", style),
+				handler: countdownHandler,
+				query:   "until=2026-01-03T22:33:44Z&k=4&format=png&style=" + style,
+			},
+			goldenCase{
+				name:    fmt.Sprintf("elapsed_%s.png", style),
+				handler: elapsedHandler,
+				query:   "since=2026-01-01T10:59:30Z&k=4&format=png&style=" + style,
+			},
+		)
+	}
+
+	cases = append(cases,
+		goldenCase{
+			name:    "world_default.png",
+			handler: worldHandler,
+			query:   "k=2",
+		},
+		goldenCase{
+			name:    "world_12h_segment.png",
+			handler: worldHandler,
+			query:   "zones=UTC,Asia/Kolkata,America/New_York,Australia/Sydney&cols=2&mode=12h&style=segment&k=2",
+		},
+	)
+	return cases
+}
+
+// TestGolden renders every case and compares it with its file in
+// testdata/golden. Run with -update to rewrite the files. A failing raster case
+// leaves a .diff.png next to its reference.
+func TestGolden(t *testing.T) {
+	defer func(old func() time.Time) { timeNow = old }(timeNow)
+	timeNow = func() time.Time { return goldenNow }
+
+	if *update {
+		if err := os.MkdirAll(goldenDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range goldenCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler(rec, httptest.NewRequest("GET", "/?"+strings.ReplaceAll(tc.query, " ", "+"), nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+
+			path := filepath.Join(goldenDir, tc.name)
+			got := rec.Body.Bytes()
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if err := compareGolden(tc, path, got, want); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func compareGolden(tc goldenCase, path string, got, want []byte) error {
+	ext := filepath.Ext(tc.name)
+	if ext == ".svg" || ext == ".txt" {
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("output differs from %s", path)
+		}
+		return nil
+	}
+
+	gotImg, err := decodeGolden(ext, got)
+	if err != nil {
+		return fmt.Errorf("decoding output: %w", err)
+	}
+	wantImg, err := decodeGolden(ext, want)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	diff, n := diffImages(gotImg, wantImg, tc.tolerance)
+	if n == 0 {
+		return nil
+	}
+	diffPath := path + ".diff.png"
+	f, err := os.Create(diffPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, diff); err != nil {
+		return err
+	}
+	if gb, wb := gotImg.Bounds(), wantImg.Bounds(); gb != wb {
+		return fmt.Errorf("size %v, want %v, see %s", gb.Size(), wb.Size(), diffPath)
+	}
+	return fmt.Errorf("%d pixels differ, see %s", n, diffPath)
+}
+
+func decodeGolden(ext string, data []byte) (image.Image, error) {
+	r := bytes.NewReader(data)
+	switch ext {
+	case ".png":
+		return png.Decode(r)
+	case ".gif":
+		return gif.Decode(r)
+	case ".jpeg":
+		return jpeg.Decode(r)
+	}
+	return nil, fmt.Errorf("unknown image type %q", ext)
+}
+
+// diffImages returns a faded copy of want with every differing pixel painted
+// red, and how many pixels differ by more than tolerance in any channel. The
+// diff covers both images, and pixels only one of them has count as differing.
+func diffImages(got, want image.Image, tolerance int) (*image.RGBA, int) {
+	b := got.Bounds().Union(want.Bounds())
+	diff := image.NewRGBA(b)
+	draw.Draw(diff, want.Bounds(), want, want.Bounds().Min, draw.Src)
+	draw.Draw(diff, b, image.NewUniform(color.NRGBA{255, 255, 255, 192}), image.Point{}, draw.Over)
+
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := image.Pt(x, y)
+			if !p.In(got.Bounds()) || !p.In(want.Bounds()) {
+				diff.Set(x, y, color.RGBA{255, 0, 0, 255})
+				n++
+				continue
+			}
+			g := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA)
+			w := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+			if channelDiff(g.R, w.R) > tolerance || channelDiff(g.G, w.G) > tolerance ||
+				channelDiff(g.B, w.B) > tolerance || channelDiff(g.A, w.A) > tolerance {
+				diff.Set(x, y, color.RGBA{255, 0, 0, 255})
+				n++
+			}
+		}
+	}
+	return diff, n
+}
+
+func channelDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -1,98 +1,367 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"flag"
 	"fmt"
-	"image"
-	"image/color"
-	"image/png"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
-	"strings"
+	"syscall"
 	"time"
 )
 
+var (
+	fonts  = NewFontRegistry()
+	images = newImageCache(512)
+
+	// timeNow is the clock the endpoints draw. Golden tests pin it.
+	timeNow = time.Now
+)
+
 func main() {
 	port := flag.String("port", "", "port to listen on")
+	fontDir := flag.String("fonts", "", "directory with extra .bdf and .txt fonts")
+	tty := flag.Bool("tty", false, "draw the clock in this terminal instead of serving HTTP")
+	query := flag.String("query", "", "rendering options for -tty, as a URL query (e.g. tz=UTC&fg=red)")
+	rate := flag.Float64("rate", 10, "requests per second allowed per client IP")
+	burst := flag.Float64("burst", 30, "request burst allowed per client IP")
 	flag.Parse()
+	if *fontDir != "" {
+		if err := fonts.LoadDir(*fontDir); err != nil {
+			fmt.Fprintln(os.Stderr, "loading fonts:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *tty {
+		if err := runTTY(*query); err != nil {
+			fmt.Fprintln(os.Stderr, "tty:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *port == "" {
 		fmt.Fprintln(os.Stderr, "port is required")
 		os.Exit(1)
 	}
+	// Written this way round so that NaN is rejected too.
+	if !(*rate > 0) || !(*burst > 0) {
+		fmt.Fprintln(os.Stderr, "rate and burst must be positive")
+		os.Exit(1)
+	}
 
-	http.HandleFunc("/", clockHandler)
-	if err := http.ListenAndServe(":"+*port, nil); err != nil {
+	if err := serve(":"+*port, *rate, *burst); err != nil {
 		fmt.Fprintln(os.Stderr, "server failed:", err)
 		os.Exit(1)
 	}
 }
 
-func clockHandler(rw http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
+// serve runs the HTTP server until SIGINT or SIGTERM, then lets in-flight
+// requests finish. Open streams see their request context cancelled.
+func serve(addr string, rate, burst float64) error {
+	clocks := http.NewServeMux()
+	clocks.HandleFunc("/", clockHandler)
+	clocks.HandleFunc("/animated", animatedHandler)
+	clocks.HandleFunc("/stream", streamHandler)
+	clocks.HandleFunc("/world", worldHandler)
+	clocks.HandleFunc("/countdown", countdownHandler)
+	clocks.HandleFunc("/elapsed", elapsedHandler)
+	clocks.HandleFunc("/events", eventsHandler)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.Handle("/", newRateLimiter(rate, burst).wrap(clocks))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(cancelBase)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
 
-	k := 1
+// clockLayouts maps ?mode= to the time layout it renders. Mode "text" renders
+// ?text= verbatim instead.
+var clockLayouts = map[string]string{
+	"24h":  "15:04:05",
+	"12h":  "03:04:05 PM",
+	"hm":   "15:04",
+	"date": "2006-01-02",
+}
+
+const maxTextLen = 32
+
+// renderParams holds the query parameters shared by every rendering endpoint.
+type renderParams struct {
+	k       int
+	font    *Font
+	colors  colorParams
+	loc     *time.Location
+	mode    string
+	layout  string
+	spacing int
+	style   string
+	scale   float64
+}
+
+func parseRenderParams(q url.Values) (renderParams, error) {
+	p := renderParams{k: 1}
 	if ks := q.Get("k"); ks != "" {
 		ki, err := strconv.Atoi(ks)
 		if err != nil || ki < 1 || ki > 30 {
-			http.Error(rw, "invalid k", http.StatusBadRequest)
-			return
+			return p, fmt.Errorf("invalid k")
 		}
-		k = ki
+		p.k = ki
+	}
+
+	var err error
+	if p.colors, err = parseColorParams(q); err != nil {
+		return p, err
+	}
+	if p.font, err = fonts.Lookup(q.Get("font")); err != nil {
+		return p, err
+	}
+	if p.loc, err = loadLocation(q.Get("tz")); err != nil {
+		return p, err
+	}
+
+	p.mode = q.Get("mode")
+	if p.mode == "" {
+		p.mode = "24h"
+	}
+	if p.mode != "text" {
+		layout, ok := clockLayouts[p.mode]
+		if !ok {
+			return p, fmt.Errorf("invalid mode %q", p.mode)
+		}
+		p.layout = layout
+	}
+
+	if ss := q.Get("spacing"); ss != "" {
+		p.spacing, err = strconv.Atoi(ss)
+		if err != nil || p.spacing < 0 || p.spacing > 8 {
+			return p, fmt.Errorf("invalid spacing")
+		}
+	}
+
+	p.style = q.Get("style")
+	switch p.style {
+	case "":
+		p.style = "bitmap"
+	case "bitmap", "segment", "dots":
+	default:
+		return p, fmt.Errorf("invalid style %q", p.style)
+	}
+
+	if ss := q.Get("scale"); ss != "" {
+		p.scale, err = strconv.ParseFloat(ss, 64)
+		if err != nil || p.scale <= 0 || p.scale > 30 {
+			return p, fmt.Errorf("invalid scale")
+		}
+		if p.style == "bitmap" && p.scale != math.Trunc(p.scale) {
+			return p, fmt.Errorf("invalid scale: fractional scale needs style segment or dots")
+		}
+		if p.style == "bitmap" {
+			p.k, p.scale = int(p.scale), 0
+		}
+	}
+	return p, nil
+}
+
+// clockParams parses the render parameters of an endpoint that draws the
+// clock itself and so has no text mode. It answers 400 with why on failure.
+func clockParams(rw http.ResponseWriter, q url.Values, why string) (renderParams, bool) {
+	params, err := parseRenderParams(q)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return params, false
+	}
+	if params.mode == "text" {
+		http.Error(rw, "invalid mode: "+why, http.StatusBadRequest)
+		return params, false
+	}
+	return params, true
+}
+
+// startStream prepares rw for a response that lasts until the client goes
+// away, or answers 500 if rw cannot flush. The server's write timeout is meant
+// for single images, so it is lifted.
+func startStream(rw http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return nil, false
+	}
+	_ = http.NewResponseController(rw).SetWriteDeadline(time.Time{})
+	return flusher, true
+}
+
+func (p renderParams) frame(text string) (*frame, error) {
+	var (
+		fr  *frame
+		err error
+	)
+	switch p.style {
+	case "segment":
+		fr, err = layoutSegments(text, p.colors)
+	case "dots":
+		fr, err = layoutDots(p.font, text, p.spacing, p.colors)
+	default:
+		return layoutText(p.font, text, p.spacing, p.colors)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fr.scale = p.scale
+	return fr, nil
+}
+
+// format renders t in the requested mode; it must not be called in text mode.
+func (p renderParams) format(t time.Time) string {
+	return t.In(p.loc).Format(p.layout)
+}
+
+// clockText returns what clockHandler should draw: ?text= in text mode, else
+// ?time= checked against the mode's layout, else the current time.
+func clockText(q url.Values, p renderParams) (string, error) {
+	if p.mode == "text" {
+		text := q.Get("text")
+		if text == "" || len([]rune(text)) > maxTextLen {
+			return "", fmt.Errorf("invalid text: want 1..%d characters", maxTextLen)
+		}
+		return text, nil
 	}
 
 	timeStr := q.Get("time")
 	if timeStr == "" {
-		timeStr = time.Now().Format("15:04:05")
-	} else {
+		return p.format(timeNow()), nil
+	}
+	if p.mode == "24h" {
 		if !validTimeFormat(timeStr) {
-			http.Error(rw, "invalid time", http.StatusBadRequest)
-			return
+			return "", fmt.Errorf("invalid time")
 		}
+		return timeStr, nil
+	}
+	if t, err := time.Parse(p.layout, timeStr); err != nil || t.Format(p.layout) != timeStr {
+		return "", fmt.Errorf("invalid time: want layout %q", p.layout)
 	}
+	return timeStr, nil
+}
 
-	symbols := []string{}
-	for _, ch := range timeStr {
-		sym := bitmapFor(ch)
-		if sym == "" {
-			http.Error(rw, "invalid time", http.StatusBadRequest)
-			return
-		}
-		symbols = append(symbols, sym)
+func clockHandler(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	params, err := parseRenderParams(q)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	first := strings.Split(symbols[0], "\n")
+	timeStr, err := clockText(q, params)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	width := (6*len(first[0]) + 2*len(strings.Split(Colon, "\n")[0])) * k
-	height := len(first) * k
+	fr, err := params.frame(timeStr)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			img.Set(x, y, color.White)
-		}
+	if q.Get("time") != "" || params.mode == "text" {
+		// The picture no longer depends on the clock.
+		rw.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	serveFrame(rw, r, fr, params.k)
+}
+
+// serveFrame encodes fr in the format negotiated for r, reusing an earlier
+// encoding from the image cache when there is one.
+func serveFrame(rw http.ResponseWriter, r *http.Request, fr *frame, k int) {
+	format, err := negotiateFormat(r)
+	if err == errNotAcceptable {
+		http.Error(rw, err.Error(), http.StatusNotAcceptable)
+		return
+	} else if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if fr.shapes != nil && format.name == "txt" {
+		http.Error(rw, "invalid format: txt needs style bitmap", http.StatusBadRequest)
+		return
 	}
 
-	offX := 0
-	for _, sym := range symbols {
-		block := strings.Split(sym, "\n")
-		for sy, row := range block {
-			for sx, pixel := range row {
-				if pixel != '.' {
-					for dy := 0; dy < k; dy++ {
-						for dx := 0; dx < k; dx++ {
-							img.Set(offX+sx*k+dx, sy*k+dy, Cyan)
-						}
-					}
-				}
-			}
+	key := fmt.Sprintf("%s|%d|%s", format.name, k, fr.cacheKey())
+	cached, ok := images.Get(key)
+	metrics.observeCache(ok)
+	if !ok {
+		start := time.Now()
+		var buf bytes.Buffer
+		if err := format.encode(&buf, fr, k); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sum := sha1.Sum(buf.Bytes())
+		cached = &cachedImage{
+			key:         key,
+			body:        buf.Bytes(),
+			etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+			contentType: format.contentType,
 		}
-		offX += len(block[0]) * k
+		images.Add(cached)
+		metrics.observeRender(format.name, time.Since(start))
 	}
 
-	rw.Header().Set("Content-Type", "image/png")
+	h := rw.Header()
+	h.Set("Content-Type", cached.contentType)
+	h.Set("ETag", cached.etag)
+	h.Add("Vary", "Accept")
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", "public, max-age=1")
+	}
+	if r.Header.Get("If-None-Match") == cached.etag {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
 	rw.WriteHeader(http.StatusOK)
-	_ = png.Encode(rw, img)
+	_, _ = rw.Write(cached.body)
 }
 
 func validTimeFormat(s string) bool {
@@ -119,32 +388,3 @@ func validTimeFormat(s string) bool {
 	}
 	return true
 }
-
-func bitmapFor(ch rune) string {
-	switch ch {
-	case '0':
-		return Zero
-	case '1':
-		return One
-	case '2':
-		return Two
-	case '3':
-		return Three
-	case '4':
-		return Four
-	case '5':
-		return Five
-	case '6':
-		return Six
-	case '7':
-		return Seven
-	case '8':
-		return Eight
-	case '9':
-		return Nine
-	case ':':
-		return Colon
-	default:
-		return ""
-	}
-}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var renderBuckets = [...]float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// serverMetrics is exported on /metrics in the Prometheus text format.
+type serverMetrics struct {
+	mu          sync.Mutex
+	renders     map[string]uint64
+	cacheHits   uint64
+	cacheMisses uint64
+	rateLimited uint64
+	// latency[i] counts renders no slower than renderBuckets[i]; the last
+	// entry counts all of them.
+	latency    [len(renderBuckets) + 1]uint64
+	latencySum float64
+}
+
+var metrics = &serverMetrics{renders: make(map[string]uint64)}
+
+func (m *serverMetrics) observeRender(format string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.renders[format]++
+	secs := d.Seconds()
+	m.latencySum += secs
+	for i, le := range renderBuckets {
+		if secs <= le {
+			m.latency[i]++
+		}
+	}
+	m.latency[len(renderBuckets)]++
+}
+
+func (m *serverMetrics) observeCache(hit bool) {
+	m.mu.Lock()
+	if hit {
+		m.cacheHits++
+	} else {
+		m.cacheMisses++
+	}
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) observeRateLimited() {
+	m.mu.Lock()
+	m.rateLimited++
+	m.mu.Unlock()
+}
+
+func metricsHandler(rw http.ResponseWriter, r *http.Request) {
+	m := metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(rw, "# HELP digitalclock_renders_total Images rendered, by output format.")
+	fmt.Fprintln(rw, "# TYPE digitalclock_renders_total counter")
+	formats := make([]string, 0, len(m.renders))
+	for f := range m.renders {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	for _, f := range formats {
+		fmt.Fprintf(rw, "digitalclock_renders_total{format=%q} %d\n", f, m.renders[f])
+	}
+
+	fmt.Fprintln(rw, "# HELP digitalclock_cache_hits_total Responses served from the image cache.")
+	fmt.Fprintln(rw, "# TYPE digitalclock_cache_hits_total counter")
+	fmt.Fprintf(rw, "digitalclock_cache_hits_total %d\n", m.cacheHits)
+	fmt.Fprintln(rw, "# HELP digitalclock_cache_misses_total Responses that had to be rendered.")
+	fmt.Fprintln(rw, "# TYPE digitalclock_cache_misses_total counter")
+	fmt.Fprintf(rw, "digitalclock_cache_misses_total %d\n", m.cacheMisses)
+
+	fmt.Fprintln(rw, "# HELP digitalclock_rate_limited_total Requests rejected by the per-IP rate limit.")
+	fmt.Fprintln(rw, "# TYPE digitalclock_rate_limited_total counter")
+	fmt.Fprintf(rw, "digitalclock_rate_limited_total %d\n", m.rateLimited)
+
+	fmt.Fprintln(rw, "# HELP digitalclock_render_duration_seconds Time spent rendering and encoding an image.")
+	fmt.Fprintln(rw, "# TYPE digitalclock_render_duration_seconds histogram")
+	for i, le := range renderBuckets {
+		fmt.Fprintf(rw, "digitalclock_render_duration_seconds_bucket{le=\"%g\"} %d\n", le, m.latency[i])
+	}
+	total := m.latency[len(renderBuckets)]
+	fmt.Fprintf(rw, "digitalclock_render_duration_seconds_bucket{le=\"+Inf\"} %d\n", total)
+	fmt.Fprintf(rw, "digitalclock_render_duration_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(rw, "digitalclock_render_duration_seconds_count %d\n", total)
+}
+
+func healthzHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(rw, "ok")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket per client IP. A request costs more tokens
+// the larger its k, since rendering time grows with k², and /world and
+// /animated pay that for every image they draw.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// idleBucket is how long an unused bucket is kept; by then it is full anyway.
+const idleBucket = 10 * time.Minute
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	l := &rateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+	}
+	go l.sweep()
+	return l
+}
+
+func (l *rateLimiter) sweep() {
+	for range time.Tick(idleBucket) {
+		l.mu.Lock()
+		for ip, b := range l.buckets {
+			if time.Since(b.last) > idleBucket {
+				delete(l.buckets, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// allow takes cost tokens from ip's bucket, or reports how long to wait.
+func (l *rateLimiter) allow(ip string, cost float64) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	cost = math.Min(cost, l.burst)
+	if b.tokens < cost {
+		wait := time.Duration((cost - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens -= cost
+	return true, 0
+}
+
+func requestCost(r *http.Request) float64 {
+	k, err := strconv.ParseFloat(r.URL.Query().Get("k"), 64)
+	if err != nil || k < 1 {
+		k = 1
+	}
+	if s, err := strconv.ParseFloat(r.URL.Query().Get("scale"), 64); err == nil && s > k {
+		k = s
+	}
+	return math.Max(1, k*k/100) * float64(imageCount(r))
+}
+
+// imageCount is how many clocks r draws: one per zone for /world and one per
+// frame for /animated. An n the handler rejects counts as the default.
+func imageCount(r *http.Request) int {
+	q := r.URL.Query()
+	switch r.URL.Path {
+	case "/world":
+		if zs := q.Get("zones"); zs != "" {
+			return strings.Count(zs, ",") + 1
+		}
+		return len(defaultWorldZones)
+	case "/animated":
+		if n, err := strconv.Atoi(q.Get("n")); err == nil && n >= 1 && n <= maxAnimatedSeconds {
+			return n
+		}
+		return defaultAnimatedSeconds
+	}
+	return 1
+}
+
+func (l *rateLimiter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		if ok, wait := l.allow(ip, requestCost(r)); !ok {
+			metrics.observeRateLimited()
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(rw, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestCost(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		want   float64
+	}{
+		{"/?k=4", 1},
+		{"/?k=20", 4},
+		{"/world?k=20", 4 * float64(len(defaultWorldZones))},
+		{"/world?zones=UTC,Asia/Tokyo,Europe/Paris", 3},
+		{"/animated", defaultAnimatedSeconds},
+		{"/animated?n=100&k=20", 400},
+		{"/animated?n=1000", defaultAnimatedSeconds},
+	} {
+		if got := requestCost(httptest.NewRequest("GET", tc.target, nil)); got != tc.want {
+			t.Errorf("%s: cost %v, want %v", tc.target, got, tc.want)
+		}
+	}
+}
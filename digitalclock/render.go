@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"sync"
+)
+
+type placedGlyph struct {
+	Glyph
+	ch     rune
+	x, y   int
+	hidden bool
+}
+
+// frame is a line of glyphs laid out left to right, measured in font pixels.
+// Its size comes from the glyphs themselves, and glyphs shorter than the
+// tallest one sit on the common baseline.
+type frame struct {
+	symbols []placedGlyph
+	colors  colorParams
+	width   int
+	height  int
+	font    *Font
+	spacing int
+
+	// Vector styles draw shapes instead of copying glyph bitmaps. scale, when
+	// set, replaces the integer k for them.
+	style  string
+	shapes []shape
+	scale  float64
+}
+
+func newFrame(font *Font, text string, colors colorParams) (*frame, error) {
+	return layoutText(font, text, 0, colors)
+}
+
+// layoutText places the glyphs of text with spacing blank font pixels between
+// neighbours.
+func layoutText(font *Font, text string, spacing int, colors colorParams) (*frame, error) {
+	f := &frame{colors: colors, font: font, spacing: spacing}
+	for _, ch := range text {
+		sym, err := font.Glyph(ch)
+		if err != nil {
+			return nil, err
+		}
+		if len(f.symbols) > 0 {
+			f.width += spacing
+		}
+		f.symbols = append(f.symbols, placedGlyph{Glyph: sym, ch: ch, x: f.width})
+		f.width += sym.Width()
+		if sym.Height() > f.height {
+			f.height = sym.Height()
+		}
+	}
+	if len(f.symbols) == 0 {
+		return nil, fmt.Errorf("nothing to render")
+	}
+
+	for i := range f.symbols {
+		f.symbols[i].y = f.height - f.symbols[i].Height()
+	}
+	return f, nil
+}
+
+// eachLit calls fn for every lit font pixel with the colour of its glyph.
+func (f *frame) eachLit(fn func(x, y int, c color.NRGBA)) {
+	for i, sym := range f.symbols {
+		if sym.hidden {
+			continue
+		}
+		fg := f.colors.glyphColor(i, len(f.symbols))
+		for sy, row := range sym.Rows {
+			for sx, pixel := range row {
+				if pixel != '.' {
+					fn(sym.x+sx, sym.y+sy, fg)
+				}
+			}
+		}
+	}
+}
+
+// hide blanks every ch glyph while keeping its space in the layout.
+func (f *frame) hide(ch rune) {
+	for i := range f.symbols {
+		if f.symbols[i].ch == ch {
+			f.symbols[i].hidden = true
+		}
+	}
+}
+
+// cacheKey identifies everything that affects how the frame looks.
+func (f *frame) cacheKey() string {
+	font := ""
+	if f.font != nil {
+		font = f.font.Name
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s|%g|%d|%v|%v|%v|%t|", f.style, font, f.scale, f.spacing,
+		f.colors.fg, f.colors.bg, f.colors.palette, f.colors.gradient)
+	for _, sym := range f.symbols {
+		if sym.hidden {
+			b.WriteByte(0)
+		}
+		b.WriteRune(sym.ch)
+	}
+	return b.String()
+}
+
+// rasterize fills the background one row at a time and then copies
+// pre-scaled glyph tiles straight into img.Pix.
+func (f *frame) rasterize(k int) *image.RGBA {
+	if f.shapes != nil {
+		return f.rasterizeShapes(f.pixelScale(k))
+	}
+
+	width, height := f.width*k, f.height*k
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width == 0 || height == 0 {
+		return img
+	}
+
+	bg := toRGBA(f.colors.bg)
+	row := img.Pix[:width*4]
+	for x := 0; x < width; x++ {
+		row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = bg.R, bg.G, bg.B, bg.A
+	}
+	for y := 1; y < height; y++ {
+		copy(img.Pix[y*img.Stride:], row)
+	}
+
+	for i, sym := range f.symbols {
+		if sym.hidden {
+			continue
+		}
+		fg := toRGBA(f.colors.glyphColor(i, len(f.symbols)))
+		tile := glyphTile(f.font, sym.ch, sym.Glyph, k, fg, bg)
+		tileRow := tile.Bounds().Dx() * 4
+		for ty := 0; ty < tile.Bounds().Dy(); ty++ {
+			dst := (sym.y*k+ty)*img.Stride + sym.x*k*4
+			copy(img.Pix[dst:dst+tileRow], tile.Pix[ty*tile.Stride:])
+		}
+	}
+	return img
+}
+
+func (f *frame) pixelScale(k int) float64 {
+	if f.scale > 0 {
+		return f.scale
+	}
+	return float64(k)
+}
+
+// toRGBA premultiplies c like color.RGBAModel, without boxing it in an
+// interface on every glyph.
+func toRGBA(c color.NRGBA) color.RGBA {
+	r, g, b, a := c.RGBA()
+	return color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+}
+
+// tileKey names a glyph by its font and rune. Fonts are compared by pointer,
+// since the label font and a user font may share a name.
+type tileKey struct {
+	font   *Font
+	ch     rune
+	k      int
+	fg, bg color.RGBA
+}
+
+const maxTiles = 1024
+
+var (
+	tilesMu sync.Mutex
+	tiles   = make(map[tileKey]*image.RGBA)
+)
+
+// glyphTile returns g, the ch glyph of font, scaled by k and painted fg on bg,
+// rasterising it on first use. The tile cache is simply dropped when it fills
+// up.
+func glyphTile(font *Font, ch rune, g Glyph, k int, fg, bg color.RGBA) *image.RGBA {
+	key := tileKey{font: font, ch: ch, k: k, fg: fg, bg: bg}
+
+	tilesMu.Lock()
+	tile, ok := tiles[key]
+	tilesMu.Unlock()
+	if ok {
+		return tile
+	}
+
+	w, h := g.Width()*k, g.Height()*k
+	tile = image.NewRGBA(image.Rect(0, 0, w, h))
+	for sy, row := range g.Rows {
+		line := tile.Pix[sy*k*tile.Stride : sy*k*tile.Stride+w*4]
+		for sx, pixel := range row {
+			c := bg
+			if pixel != '.' {
+				c = fg
+			}
+			for dx := 0; dx < k; dx++ {
+				i := (sx*k + dx) * 4
+				line[i], line[i+1], line[i+2], line[i+3] = c.R, c.G, c.B, c.A
+			}
+		}
+		for dy := 1; dy < k; dy++ {
+			copy(tile.Pix[(sy*k+dy)*tile.Stride:], line)
+		}
+	}
+
+	tilesMu.Lock()
+	if len(tiles) >= maxTiles {
+		tiles = make(map[tileKey]*image.RGBA)
+	}
+	tiles[key] = tile
+	tilesMu.Unlock()
+	return tile
+}
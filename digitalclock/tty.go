@@ -0,0 +1,134 @@
+//go:build unix && !aix && !solaris
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// runTTY redraws the clock in the terminal every second using half-block
+// characters, two pixels per cell, with 24-bit ANSI colours. It picks the
+// largest k that fits, re-fits on SIGWINCH and returns on Ctrl-C.
+func runTTY(query string) error {
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("invalid -query: %w", err)
+	}
+	params, err := parseRenderParams(q)
+	if err != nil {
+		return err
+	}
+	if params.mode == "text" {
+		return fmt.Errorf("mode text is not supported in -tty")
+	}
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(winch)
+	defer signal.Stop(stop)
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(out, "\x1b[?25l\x1b[2J")
+	defer func() {
+		fmt.Fprint(out, "\x1b[0m\x1b[2J\x1b[H\x1b[?25h")
+		out.Flush()
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := drawTTY(out, params); err != nil {
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-winch:
+			fmt.Fprint(out, "\x1b[2J")
+		case <-ticker.C:
+		}
+	}
+}
+
+func drawTTY(out *bufio.Writer, params renderParams) error {
+	cols, rows, err := termSize()
+	if err != nil {
+		return err
+	}
+
+	fr, err := params.frame(params.format(timeNow()))
+	if err != nil {
+		return err
+	}
+
+	k := 1
+	for (k+1)*fr.width <= cols && (k+1)*fr.height <= 2*rows {
+		k++
+	}
+	if fr.width > cols || fr.height > 2*rows {
+		fmt.Fprint(out, "\x1b[H\x1b[0mterminal too small\x1b[K")
+		return nil
+	}
+	if fr.shapes != nil {
+		fr.scale = float64(k)
+	}
+	img := fr.rasterize(k)
+
+	b := img.Bounds()
+	padX := (cols - b.Dx()) / 2
+	padY := (2*rows - b.Dy()) / 4
+	fmt.Fprint(out, "\x1b[H")
+	for i := 0; i < padY; i++ {
+		fmt.Fprint(out, "\x1b[0m\x1b[K\n")
+	}
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		fmt.Fprintf(out, "\x1b[0m%*s", padX, "")
+		for x := b.Min.X; x < b.Max.X; x++ {
+			fmt.Fprint(out, ansiColor(img, x, y, 38), ansiColor(img, x, y+1, 48), "▀")
+		}
+		fmt.Fprint(out, "\x1b[0m\x1b[K\n")
+	}
+	fmt.Fprint(out, "\x1b[J")
+	return nil
+}
+
+// ansiColor returns the SGR sequence setting the foreground (base 38) or
+// background (base 48) to the pixel at (x, y). Mostly transparent or missing
+// pixels keep the terminal's default colour.
+func ansiColor(img *image.RGBA, x, y, base int) string {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return fmt.Sprintf("\x1b[%dm", base+1)
+	}
+	c := img.RGBAAt(x, y)
+	if c.A < 128 {
+		return fmt.Sprintf("\x1b[%dm", base+1)
+	}
+	return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", base, c.R, c.G, c.B)
+}
+
+func termSize() (cols, rows int, err error) {
+	var ws struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(),
+		uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, fmt.Errorf("reading terminal size: %w", errno)
+	}
+	return int(ws.cols), int(ws.rows), nil
+}
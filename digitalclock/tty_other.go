@@ -0,0 +1,9 @@
+//go:build !unix || aix || solaris
+
+package main
+
+import "fmt"
+
+func runTTY(query string) error {
+	return fmt.Errorf("-tty is not supported on this platform")
+}
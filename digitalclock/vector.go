@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+type point struct {
+	x, y float64
+}
+
+// shape is a filled polygon, or a circle when poly is nil. Coordinates are in
+// font pixels, like frame.width and frame.height.
+type shape struct {
+	poly      []point
+	cx, cy, r float64
+	color     color.NRGBA
+	// glyph is the index of the symbol the shape belongs to, so hidden
+	// symbols can be skipped.
+	glyph int
+}
+
+func (s shape) contains(x, y float64) bool {
+	if s.poly == nil {
+		dx, dy := x-s.cx, y-s.cy
+		return dx*dx+dy*dy <= s.r*s.r
+	}
+
+	in := false
+	for i, j := 0, len(s.poly)-1; i < len(s.poly); j, i = i, i+1 {
+		a, b := s.poly[i], s.poly[j]
+		if (a.y > y) != (b.y > y) && x < (b.x-a.x)*(y-a.y)/(b.y-a.y)+a.x {
+			in = !in
+		}
+	}
+	return in
+}
+
+func (s shape) bounds() (minX, minY, maxX, maxY float64) {
+	if s.poly == nil {
+		return s.cx - s.r, s.cy - s.r, s.cx + s.r, s.cy + s.r
+	}
+
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, p := range s.poly {
+		minX, maxX = math.Min(minX, p.x), math.Max(maxX, p.x)
+		minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+	}
+	return
+}
+
+// aaSamples is the supersampling grid per axis used for anti-aliasing.
+const aaSamples = 4
+
+// fill composites s over img at the given pixels per font pixel.
+func (s shape) fill(img *image.RGBA, scale float64) {
+	minX, minY, maxX, maxY := s.bounds()
+	b := img.Bounds()
+	x0, y0 := max(b.Min.X, int(minX*scale)), max(b.Min.Y, int(minY*scale))
+	x1, y1 := min(b.Max.X, int(math.Ceil(maxX*scale))), min(b.Max.Y, int(math.Ceil(maxY*scale)))
+
+	src := toRGBA(s.color)
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			hits := 0
+			for sy := 0; sy < aaSamples; sy++ {
+				for sx := 0; sx < aaSamples; sx++ {
+					x := (float64(px) + (float64(sx)+0.5)/aaSamples) / scale
+					y := (float64(py) + (float64(sy)+0.5)/aaSamples) / scale
+					if s.contains(x, y) {
+						hits++
+					}
+				}
+			}
+			if hits > 0 {
+				blendOver(img, px, py, src, hits, aaSamples*aaSamples)
+			}
+		}
+	}
+}
+
+// blendOver composites src, scaled by coverage num/den, over the premultiplied
+// pixel at (x, y).
+func blendOver(img *image.RGBA, x, y int, src color.RGBA, num, den int) {
+	i := img.PixOffset(x, y)
+	pix := img.Pix[i : i+4 : i+4]
+	sa := int(src.A) * num / den
+	for c, v := range [4]uint8{src.R, src.G, src.B, src.A} {
+		sv := int(v) * num / den
+		pix[c] = uint8(sv + int(pix[c])*(255-sa)/255)
+	}
+}
+
+func dim(c color.NRGBA) color.NRGBA {
+	c.A = uint8(int(c.A) * 3 / 20)
+	return c
+}
+
+// segmentMasks lists the lit segments per character, using the usual a-g
+// naming: a top, b upper right, c lower right, d bottom, e lower left,
+// f upper left, g middle. D and M have no real seven-segment form and are
+// drawn the usual way, as a lowercase d and an upside-down U.
+var segmentMasks = map[rune]string{
+	'0': "abcdef", '1': "bc", '2': "abdeg", '3': "abcdg", '4': "bcfg",
+	'5': "acdfg", '6': "acdefg", '7': "abc", '8': "abcdefg", '9': "abcdfg",
+	'-': "g", ' ': "", 'A': "abcefg", 'P': "abefg", 'D': "bcdeg", 'M': "abcef",
+}
+
+// Seven-segment geometry in font pixels, sized to match the 7 pixel high
+// default font.
+const (
+	segAdvance   = 6.0
+	segThickness = 0.8
+	segGap       = 0.12
+	segLeft      = 0.5
+	segRight     = 4.5
+	segTop       = 0.5
+	segMiddle    = 3.5
+	segBottom    = 6.5
+	segHeight    = 7.0
+	colonAdvance = 2.0
+)
+
+func hSegment(x0, x1, y float64) []point {
+	h := segThickness / 2
+	return []point{{x0, y}, {x0 + h, y - h}, {x1 - h, y - h}, {x1, y}, {x1 - h, y + h}, {x0 + h, y + h}}
+}
+
+func vSegment(x, y0, y1 float64) []point {
+	h := segThickness / 2
+	return []point{{x, y0}, {x + h, y0 + h}, {x + h, y1 - h}, {x, y1}, {x - h, y1 - h}, {x - h, y0 + h}}
+}
+
+func segmentPolygons(offX float64) map[byte][]point {
+	l, r := offX+segLeft, offX+segRight
+	return map[byte][]point{
+		'a': hSegment(l+segGap, r-segGap, segTop),
+		'b': vSegment(r, segTop+segGap, segMiddle-segGap),
+		'c': vSegment(r, segMiddle+segGap, segBottom-segGap),
+		'd': hSegment(l+segGap, r-segGap, segBottom),
+		'e': vSegment(l, segMiddle+segGap, segBottom-segGap),
+		'f': vSegment(l, segTop+segGap, segMiddle-segGap),
+		'g': hSegment(l+segGap, r-segGap, segMiddle),
+	}
+}
+
+// layoutSegments draws text as seven-segment digits, with unlit segments in a
+// dim shade of the glyph colour.
+func layoutSegments(text string, colors colorParams) (*frame, error) {
+	runes := []rune(text)
+	f := &frame{colors: colors, style: "segment", height: segHeight}
+
+	offX := 0.0
+	for i, ch := range runes {
+		fg := colors.glyphColor(i, len(runes))
+		if ch == ':' {
+			for _, cy := range []float64{2.5, 4.5} {
+				f.shapes = append(f.shapes, shape{cx: offX + colonAdvance/2, cy: cy, r: 0.45, color: fg, glyph: i})
+			}
+			f.symbols = append(f.symbols, placedGlyph{ch: ch})
+			offX += colonAdvance
+			continue
+		}
+
+		mask, ok := segmentMasks[ch]
+		if !ok {
+			return nil, fmt.Errorf("style segment cannot draw %q", ch)
+		}
+		polys := segmentPolygons(offX)
+		for _, seg := range []byte("abcdefg") {
+			c := dim(fg)
+			for j := 0; j < len(mask); j++ {
+				if mask[j] == seg {
+					c = fg
+				}
+			}
+			f.shapes = append(f.shapes, shape{poly: polys[seg], color: c, glyph: i})
+		}
+		f.symbols = append(f.symbols, placedGlyph{ch: ch})
+		offX += segAdvance
+	}
+	if len(runes) == 0 {
+		return nil, fmt.Errorf("nothing to render")
+	}
+
+	f.width = int(math.Ceil(offX))
+	return f, nil
+}
+
+// layoutDots lays text out like layoutText and then draws every font pixel as
+// a round LED, dim when unlit.
+func layoutDots(font *Font, text string, spacing int, colors colorParams) (*frame, error) {
+	f, err := layoutText(font, text, spacing, colors)
+	if err != nil {
+		return nil, err
+	}
+
+	f.style = "dots"
+	f.shapes = []shape{}
+	for i, sym := range f.symbols {
+		fg := colors.glyphColor(i, len(f.symbols))
+		for sy, row := range sym.Rows {
+			for sx, pixel := range row {
+				c := fg
+				if pixel == '.' {
+					c = dim(fg)
+				}
+				f.shapes = append(f.shapes, shape{
+					cx:    float64(sym.x+sx) + 0.5,
+					cy:    float64(sym.y+sy) + 0.5,
+					r:     0.42,
+					color: c,
+					glyph: i,
+				})
+			}
+		}
+	}
+	return f, nil
+}
+
+func (f *frame) rasterizeShapes(scale float64) *image.RGBA {
+	width := int(math.Ceil(float64(f.width) * scale))
+	height := int(math.Ceil(float64(f.height) * scale))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	bg := toRGBA(f.colors.bg)
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = bg.R, bg.G, bg.B, bg.A
+	}
+	for _, s := range f.visibleShapes() {
+		s.fill(img, scale)
+	}
+	return img
+}
+
+func (f *frame) visibleShapes() []shape {
+	visible := make([]shape, 0, len(f.shapes))
+	for _, s := range f.shapes {
+		if !f.symbols[s.glyph].hidden {
+			visible = append(visible, s)
+		}
+	}
+	return visible
+}
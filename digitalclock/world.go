@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	// Embedded so ?tz= works on hosts without a zoneinfo database.
+	_ "time/tzdata"
+)
+
+var defaultWorldZones = []string{
+	"UTC",
+	"Europe/London",
+	"Europe/Moscow",
+	"Asia/Tokyo",
+	"America/New_York",
+	"America/Los_Angeles",
+}
+
+// labelGlyphs is a 3x5 font for zone names under the clocks. Rows are
+// separated by '|'.
+var labelGlyphs = map[rune]string{
+	'A': ".#.|#.#|###|#.#|#.#", 'B': "##.|#.#|##.|#.#|##.",
+	'C': ".##|#..|#..|#..|.##", 'D': "##.|#.#|#.#|#.#|##.",
+	'E': "###|#..|##.|#..|###", 'F': "###|#..|##.|#..|#..",
+	'G': ".##|#..|#.#|#.#|.##", 'H': "#.#|#.#|###|#.#|#.#",
+	'I': "###|.#.|.#.|.#.|###", 'J': "..#|..#|..#|#.#|.#.",
+	'K': "#.#|#.#|##.|#.#|#.#", 'L': "#..|#..|#..|#..|###",
+	'M': "#.#|###|###|#.#|#.#", 'N': "##.|#.#|#.#|#.#|#.#",
+	'O': ".#.|#.#|#.#|#.#|.#.", 'P': "##.|#.#|##.|#..|#..",
+	'Q': ".#.|#.#|#.#|##.|.##", 'R': "##.|#.#|##.|#.#|#.#",
+	'S': ".##|#..|.#.|..#|##.", 'T': "###|.#.|.#.|.#.|.#.",
+	'U': "#.#|#.#|#.#|#.#|###", 'V': "#.#|#.#|#.#|#.#|.#.",
+	'W': "#.#|#.#|###|###|#.#", 'X': "#.#|#.#|.#.|#.#|#.#",
+	'Y': "#.#|#.#|.#.|.#.|.#.", 'Z': "###|..#|.#.|#..|###",
+	'0': "###|#.#|#.#|#.#|###", '1': ".#.|##.|.#.|.#.|###",
+	'2': "##.|..#|.#.|#..|###", '3': "##.|..#|.#.|..#|##.",
+	'4': "#.#|#.#|###|..#|..#", '5': "###|#..|##.|..#|##.",
+	'6': ".##|#..|###|#.#|###", '7': "###|..#|.#.|.#.|.#.",
+	'8': "###|#.#|###|#.#|###", '9': "###|#.#|###|..#|##.",
+	'/': "..#|..#|.#.|#..|#..", '_': "...|...|...|...|###",
+	'-': "...|...|###|...|...", '+': "...|.#.|###|.#.|...",
+	':': "...|.#.|...|.#.|...", '.': "...|...|...|...|.#.",
+	' ': "...|...|...|...|...",
+}
+
+var labelFont = func() *Font {
+	f := &Font{Name: "label", Height: 5, glyphs: make(map[rune]Glyph)}
+	for ch, rows := range labelGlyphs {
+		g := Glyph{Rows: strings.Split(rows, "|")}
+		for i := range g.Rows {
+			g.Rows[i] += "."
+		}
+		f.glyphs[ch] = g
+	}
+	return f
+}()
+
+// labelText upper-cases s and replaces characters the label font lacks.
+func labelText(s string) string {
+	return strings.Map(func(ch rune) rune {
+		ch = []rune(strings.ToUpper(string(ch)))[0]
+		if _, ok := labelFont.glyphs[ch]; !ok {
+			return ' '
+		}
+		return ch
+	}, s)
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q", name)
+	}
+	return loc, nil
+}
+
+// worldHandler renders one clock per zone in ?zones=, laid out in a grid of
+// ?cols= columns with the zone name under each clock.
+func worldHandler(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	params, ok := clockParams(rw, q, "world shows clocks only")
+	if !ok {
+		return
+	}
+
+	zones := defaultWorldZones
+	if zs := q.Get("zones"); zs != "" {
+		zones = strings.Split(zs, ",")
+	}
+	if len(zones) > 24 {
+		http.Error(rw, "invalid zones: at most 24", http.StatusBadRequest)
+		return
+	}
+
+	cols := 3
+	if cs := q.Get("cols"); cs != "" {
+		var err error
+		cols, err = strconv.Atoi(cs)
+		if err != nil || cols < 1 {
+			http.Error(rw, "invalid cols", http.StatusBadRequest)
+			return
+		}
+	}
+	if cols > len(zones) {
+		cols = len(zones)
+	}
+
+	now := timeNow()
+	began := time.Now()
+	var clocks, labels []*image.RGBA
+	cellW, cellH := 0, 0
+	for _, zone := range zones {
+		if zone == "" {
+			http.Error(rw, "invalid zones: empty zone name", http.StatusBadRequest)
+			return
+		}
+		loc, err := loadLocation(zone)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fr, err := params.frame(now.In(loc).Format(params.layout))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		clock := fr.rasterize(params.k)
+
+		lf, err := newFrame(labelFont, labelText(zone), colorParams{fg: params.colors.fg, bg: params.colors.bg})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		label := lf.rasterize(params.k)
+
+		clocks, labels = append(clocks, clock), append(labels, label)
+		if w := max(clock.Bounds().Dx(), label.Bounds().Dx()); w > cellW {
+			cellW = w
+		}
+		if h := clock.Bounds().Dy() + label.Bounds().Dy(); h > cellH {
+			cellH = h
+		}
+	}
+
+	pad := 2 * params.k
+	cellW += 2 * pad
+	cellH += 3 * pad
+	rows := (len(zones) + cols - 1) / cols
+
+	img := image.NewRGBA(image.Rect(0, 0, cols*cellW, rows*cellH))
+	draw.Draw(img, img.Bounds(), image.NewUniform(params.colors.bg), image.Point{}, draw.Src)
+	for i := range clocks {
+		x0, y0 := (i%cols)*cellW, (i/cols)*cellH
+		cb, lb := clocks[i].Bounds(), labels[i].Bounds()
+
+		at := image.Pt(x0+(cellW-cb.Dx())/2, y0+pad)
+		draw.Draw(img, cb.Add(at), clocks[i], image.Point{}, draw.Src)
+		at = image.Pt(x0+(cellW-lb.Dx())/2, y0+pad+cb.Dy()+pad)
+		draw.Draw(img, lb.Add(at), labels[i], image.Point{}, draw.Src)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	metrics.observeRender("png", time.Since(began))
+
+	rw.Header().Set("Content-Type", "image/png")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(buf.Bytes())
+}
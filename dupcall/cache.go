@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// timeNow is the clock entries expire by. Tests replace it.
+var timeNow = time.Now
+
+type CacheOptions struct {
+	// TTL is how long a successful result is served without calling cb.
+	TTL time.Duration
+	// ErrorTTL is how long a failed result is served; zero disables
+	// negative caching.
+	ErrorTTL time.Duration
+	// Stale is how long after TTL a successful result may still be served
+	// while a single background refresh runs.
+	Stale time.Duration
+	// RefreshTimeout bounds a background refresh. Zero means TTL plus Stale,
+	// the longest an old result can be served while it runs.
+	RefreshTimeout time.Duration
+}
+
+type cacheEntry[T any] struct {
+	res        T
+	err        error
+	expires    time.Time
+	staleUntil time.Time
+	refreshing bool
+	cb         func(context.Context) (T, error)
+}
+
+// dead reports whether e can no longer be served, not even as stale.
+func (e *cacheEntry[T]) dead(now time.Time) bool {
+	return !now.Before(e.expires) && (e.err != nil || !now.Before(e.staleUntil))
+}
+
+// cacheSlot is the state kept per key. It stays in the map while it holds an
+// entry or calls for the key are in flight.
+type cacheSlot[T any] struct {
+	entry *cacheEntry[T]
+	// version is bumped by Forget; a call only stores its result if the
+	// version did not change while it ran.
+	version uint64
+	calls   int
+}
+
+// CachedGroup is a TypedGroup that remembers results after the call finishes.
+type CachedGroup[K comparable, T any] struct {
+	opts  CacheOptions
+	group TypedGroup[K, T]
+
+	mu        sync.Mutex
+	slots     map[K]*cacheSlot[T]
+	nextSweep time.Time
+}
+
+func NewCachedGroup[K comparable, T any](opts CacheOptions) *CachedGroup[K, T] {
+	if opts.RefreshTimeout <= 0 {
+		opts.RefreshTimeout = opts.TTL + opts.Stale
+	}
+	return &CachedGroup[K, T]{
+		opts:  opts,
+		slots: make(map[K]*cacheSlot[T]),
+	}
+}
+
+func (g *CachedGroup[K, T]) Do(
+	ctx context.Context,
+	key K,
+	cb func(context.Context) (T, error),
+) (T, error) {
+	now := timeNow()
+
+	g.mu.Lock()
+	s := g.slots[key]
+	if s != nil && s.entry != nil {
+		e := s.entry
+		if now.Before(e.expires) {
+			g.mu.Unlock()
+			return e.res, e.err
+		}
+		if e.err == nil && now.Before(e.staleUntil) {
+			if !e.refreshing {
+				e.refreshing = true
+				s.calls++
+				go g.refresh(key, s.version, cb)
+			}
+			g.mu.Unlock()
+			return e.res, nil
+		}
+		s.entry = nil
+	}
+	if s == nil {
+		s = &cacheSlot[T]{}
+		g.slots[key] = s
+	}
+	s.calls++
+	version := s.version
+	g.mu.Unlock()
+
+	res, err := g.group.Do(ctx, key, cb)
+	g.store(key, version, res, err, cb)
+	return res, err
+}
+
+// Forget drops the cached result for key, so the next Do calls cb. Calls for
+// key that are already running do not store their results.
+func (g *CachedGroup[K, T]) Forget(key K) {
+	g.mu.Lock()
+	if s, ok := g.slots[key]; ok {
+		s.entry = nil
+		s.version++
+		if s.calls == 0 {
+			delete(g.slots, key)
+		}
+	}
+	g.mu.Unlock()
+	g.group.forget(key)
+}
+
+// Refresh starts a background call for key with the callback that produced
+// its cached result, and keeps serving that result until the call finishes.
+// It reports false when nothing is cached for key.
+func (g *CachedGroup[K, T]) Refresh(key K) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s, ok := g.slots[key]
+	if !ok || s.entry == nil {
+		return false
+	}
+	if e := s.entry; !e.refreshing {
+		e.refreshing = true
+		s.calls++
+		go g.refresh(key, s.version, e.cb)
+	}
+	return true
+}
+
+func (g *CachedGroup[K, T]) refresh(key K, version uint64, cb func(context.Context) (T, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.opts.RefreshTimeout)
+	defer cancel()
+
+	res, err := g.group.Do(ctx, key, cb)
+	if err != nil {
+		// Keep serving the old value until it goes stale, and let the next
+		// caller retry.
+		g.mu.Lock()
+		if s := g.slots[key]; s.version == version && s.entry != nil {
+			s.entry.refreshing = false
+		}
+		g.finishCall(key)
+		g.mu.Unlock()
+		return
+	}
+	g.store(key, version, res, err, cb)
+}
+
+// store caches the result of a call that started at version and ends it.
+func (g *CachedGroup[K, T]) store(key K, version uint64, res T, err error, cb func(context.Context) (T, error)) {
+	now := timeNow()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	defer g.finishCall(key)
+
+	// A cancelled call says nothing about the key.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	s := g.slots[key]
+	if s.version != version {
+		return
+	}
+
+	ttl := g.opts.TTL
+	if err != nil {
+		ttl = g.opts.ErrorTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	e := &cacheEntry[T]{
+		res:     res,
+		err:     err,
+		expires: now.Add(ttl),
+		cb:      cb,
+	}
+	if err == nil {
+		e.staleUntil = e.expires.Add(g.opts.Stale)
+	}
+	s.entry = e
+	g.sweep(now)
+}
+
+// finishCall ends a call counted in the slot of key and drops the slot once it
+// is empty. g.mu must be held.
+func (g *CachedGroup[K, T]) finishCall(key K) {
+	s := g.slots[key]
+	s.calls--
+	if s.calls == 0 && s.entry == nil {
+		delete(g.slots, key)
+	}
+}
+
+// sweep drops dead entries of keys nobody asked for again. It walks the map at
+// most once per entry lifetime, longest TTL plus Stale. g.mu must be held.
+func (g *CachedGroup[K, T]) sweep(now time.Time) {
+	if now.Before(g.nextSweep) {
+		return
+	}
+	g.nextSweep = now.Add(max(g.opts.TTL, g.opts.ErrorTTL) + g.opts.Stale)
+
+	for key, s := range g.slots {
+		if s.entry != nil && s.entry.dead(now) {
+			s.entry = nil
+			if s.calls == 0 {
+				delete(g.slots, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// useFakeClock makes timeNow read a clock that only moves on advance.
+func useFakeClock(t *testing.T) *fakeClock {
+	c := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	old := timeNow
+	timeNow = func() time.Time {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.now
+	}
+	t.Cleanup(func() { timeNow = old })
+	return c
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// countingCall returns a callback that returns how many times it ran. Calls
+// after the first report on started and wait for release.
+func countingCall(calls *atomic.Int64, started chan<- struct{}, release <-chan struct{}) func(context.Context) (int, error) {
+	return func(context.Context) (int, error) {
+		n := calls.Add(1)
+		if n > 1 {
+			started <- struct{}{}
+			<-release
+		}
+		return int(n), nil
+	}
+}
+
+func mustDo(t *testing.T, g *CachedGroup[string, int], cb func(context.Context) (int, error), want int) {
+	t.Helper()
+	v, err := g.Do(context.Background(), "k", cb)
+	if err != nil || v != want {
+		t.Fatalf("Do returned %d, %v, want %d", v, err, want)
+	}
+}
+
+// waitForValue polls Do until it serves want.
+func waitForValue(t *testing.T, g *CachedGroup[string, int], cb func(context.Context) (int, error), want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v, err := g.Do(context.Background(), "k", cb)
+		if err == nil && v == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Do still returns %d, %v, want %d", v, err, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitForSlots polls until no calls or entries are kept for any key.
+func waitForSlots(t *testing.T, g *CachedGroup[string, int]) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g.mu.Lock()
+		n := len(g.slots)
+		g.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d slots left", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	clock := useFakeClock(t)
+	g := NewCachedGroup[string, int](CacheOptions{TTL: time.Minute})
+	var calls atomic.Int64
+	cb := func(context.Context) (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	mustDo(t, g, cb, 1)
+	clock.advance(59 * time.Second)
+	mustDo(t, g, cb, 1)
+	clock.advance(time.Second)
+	mustDo(t, g, cb, 2)
+}
+
+func TestCacheErrorTTL(t *testing.T) {
+	clock := useFakeClock(t)
+	g := NewCachedGroup[string, int](CacheOptions{TTL: time.Minute, ErrorTTL: time.Second})
+	errBoom := errors.New("boom")
+	var calls atomic.Int64
+	cb := func(context.Context) (int, error) {
+		calls.Add(1)
+		return 0, errBoom
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.Do(context.Background(), "k", cb); err != errBoom {
+			t.Fatalf("Do returned %v, want %v", err, errBoom)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("%d calls within ErrorTTL, want 1", n)
+	}
+
+	clock.advance(time.Second)
+	g.Do(context.Background(), "k", cb)
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("%d calls after ErrorTTL, want 2", n)
+	}
+}
+
+func TestCacheStaleRefreshesOnce(t *testing.T) {
+	clock := useFakeClock(t)
+	g := NewCachedGroup[string, int](CacheOptions{TTL: time.Minute, Stale: time.Minute})
+	var calls atomic.Int64
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	cb := countingCall(&calls, started, release)
+
+	mustDo(t, g, cb, 1)
+	clock.advance(90 * time.Second)
+	for i := 0; i < 5; i++ {
+		mustDo(t, g, cb, 1)
+	}
+	<-started
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("%d calls while stale, want 2", n)
+	}
+
+	close(release)
+	waitForValue(t, g, cb, 2)
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("%d calls after the refresh, want 2", n)
+	}
+}
+
+func TestCacheRefresh(t *testing.T) {
+	useFakeClock(t)
+	g := NewCachedGroup[string, int](CacheOptions{TTL: time.Minute})
+	var calls atomic.Int64
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	cb := countingCall(&calls, started, release)
+
+	if g.Refresh("k") {
+		t.Fatal("Refresh reported true with nothing cached")
+	}
+	mustDo(t, g, cb, 1)
+
+	if !g.Refresh("k") {
+		t.Fatal("Refresh reported false for a cached key")
+	}
+	<-started
+	g.Refresh("k")
+	mustDo(t, g, cb, 1)
+
+	close(release)
+	waitForValue(t, g, cb, 2)
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("%d calls, want 2", n)
+	}
+}
+
+func TestCacheForgetInFlight(t *testing.T) {
+	useFakeClock(t)
+	g := NewCachedGroup[string, int](CacheOptions{TTL: time.Minute})
+	var calls atomic.Int64
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	cb := func(ctx context.Context) (int, error) {
+		started <- struct{}{}
+		<-release
+		return int(calls.Add(1)), nil
+	}
+
+	done := make(chan int)
+	go func() {
+		v, _ := g.Do(context.Background(), "k", cb)
+		done <- v
+	}()
+	<-started
+	g.Forget("k")
+	close(release)
+	if v := <-done; v != 1 {
+		t.Fatalf("caller in flight got %d, want 1", v)
+	}
+
+	// The forgotten call must not have stored its result.
+	mustDo(t, g, cb, 2)
+}
+
+// TestCacheForgetDuringRefresh checks that a refresh running when its key is
+// forgotten does not bring the entry back.
+func TestCacheForgetDuringRefresh(t *testing.T) {
+	useFakeClock(t)
+	g := NewCachedGroup[string, int](CacheOptions{TTL: time.Minute})
+	var calls atomic.Int64
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	cb := countingCall(&calls, started, release)
+
+	mustDo(t, g, cb, 1)
+	g.Refresh("k")
+	<-started
+	g.Forget("k")
+	close(release)
+	waitForSlots(t, g)
+
+	mustDo(t, g, cb, 3)
+}
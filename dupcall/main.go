@@ -5,93 +5,230 @@ import (
 	"sync"
 )
 
-type callGroup struct {
-	res          interface{}
+type callGroup[T any] struct {
+	res          T
 	err          error
 	done         chan struct{}
 	waiting      int
 	cancelWorker context.CancelFunc
 }
 
-type Call struct {
-	mu      sync.Mutex
-	current *callGroup
+// TypedGroup collapses concurrent calls with the same key into one execution
+// of cb. The worker is cancelled once every caller for its key has given up.
+type TypedGroup[K comparable, T any] struct {
+	mu    sync.Mutex
+	calls map[K]*callGroup[T]
+	stats Stats
 }
 
-func (c *Call) Do(
+// TypedResult is what DoChan delivers. Shared reports that the caller joined
+// an execution started by another caller.
+type TypedResult[T any] struct {
+	Val    T
+	Err    error
+	Shared bool
+}
+
+type Stats struct {
+	// Executions counts how many times a callback was started.
+	Executions uint64
+	// Served counts callers that received a callback's result.
+	Served uint64
+}
+
+func (g *TypedGroup[K, T]) Do(
 	ctx context.Context,
-	cb func(context.Context) (interface{}, error),
-) (interface{}, error) {
+	key K,
+	cb func(context.Context) (T, error),
+) (T, error) {
+	res, _, err := g.do(ctx, key, cb)
+	return res, err
+}
+
+// DoChan is Do without blocking: the result arrives on the returned channel,
+// which is buffered so nobody has to read it.
+func (g *TypedGroup[K, T]) DoChan(
+	ctx context.Context,
+	key K,
+	cb func(context.Context) (T, error),
+) <-chan TypedResult[T] {
+	ch := make(chan TypedResult[T], 1)
+	go func() {
+		res, shared, err := g.do(ctx, key, cb)
+		ch <- TypedResult[T]{Val: res, Err: err, Shared: shared}
+	}()
+	return ch
+}
+
+func (g *TypedGroup[K, T]) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
+
+func (g *TypedGroup[K, T]) do(
+	ctx context.Context,
+	key K,
+	cb func(context.Context) (T, error),
+) (T, bool, error) {
+	var zero T
+
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return zero, false, ctx.Err()
 	default:
 	}
 
-	c.mu.Lock()
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*callGroup[T])
+	}
 
-	if c.current != nil {
+	grp, ok := g.calls[key]
+	if ok {
 		select {
-		case <-c.current.done:
-			c.current = nil
+		case <-grp.done:
+			delete(g.calls, key)
+			ok = false
 		default:
 		}
 	}
-	if c.current != nil {
-		grp := c.current
+	if ok {
 		grp.waiting++
-		c.mu.Unlock()
-
-		select {
-		case <-ctx.Done():
-			c.mu.Lock()
-			grp.waiting--
-			if grp.waiting == 0 {
-				grp.cancelWorker()
-			}
-			c.mu.Unlock()
-			return nil, ctx.Err()
-		case <-grp.done:
-			res, err := grp.res, grp.err
-			c.mu.Lock()
-			grp.waiting--
-			c.mu.Unlock()
-			return res, err
-		}
+		g.mu.Unlock()
+		res, err := g.wait(ctx, key, grp)
+		return res, true, err
 	}
 
 	workerCtx, cancelWorker := context.WithCancel(context.Background())
-	grp := &callGroup{
+	grp = &callGroup[T]{
 		done:         make(chan struct{}),
 		waiting:      1,
 		cancelWorker: cancelWorker,
 	}
-	c.current = grp
-	c.mu.Unlock()
+	g.calls[key] = grp
+	g.stats.Executions++
+	g.mu.Unlock()
 
 	go func() {
 		res, err := cb(workerCtx)
-		c.mu.Lock()
+		g.mu.Lock()
 		grp.res, grp.err = res, err
 		close(grp.done)
-		c.current = nil
-		c.mu.Unlock()
+		if g.calls[key] == grp {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		cancelWorker()
 	}()
 
+	res, err := g.wait(ctx, key, grp)
+	return res, false, err
+}
+
+func (g *TypedGroup[K, T]) wait(ctx context.Context, key K, grp *callGroup[T]) (T, error) {
 	select {
 	case <-ctx.Done():
-		c.mu.Lock()
+		g.mu.Lock()
 		grp.waiting--
 		if grp.waiting == 0 {
 			grp.cancelWorker()
+			// Later callers must not join a worker that is being cancelled.
+			if g.calls[key] == grp {
+				delete(g.calls, key)
+			}
 		}
-		c.mu.Unlock()
-		return nil, ctx.Err()
+		g.mu.Unlock()
+		var zero T
+		return zero, ctx.Err()
 	case <-grp.done:
-		c.mu.Lock()
+		g.mu.Lock()
 		res, err := grp.res, grp.err
 		grp.waiting--
-		c.mu.Unlock()
+		g.stats.Served++
+		g.mu.Unlock()
 		return res, err
 	}
 }
+
+// forget makes the next Do for key start a new call instead of joining the one
+// in flight. Callers already waiting still get its result.
+func (g *TypedGroup[K, T]) forget(key K) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
+
+// TypedCall is a TypedGroup with a single key: every concurrent Do shares one
+// execution.
+type TypedCall[T any] struct {
+	group TypedGroup[struct{}, T]
+}
+
+func (c *TypedCall[T]) Do(
+	ctx context.Context,
+	cb func(context.Context) (T, error),
+) (T, error) {
+	return c.group.Do(ctx, struct{}{}, cb)
+}
+
+func (c *TypedCall[T]) DoChan(
+	ctx context.Context,
+	cb func(context.Context) (T, error),
+) <-chan TypedResult[T] {
+	return c.group.DoChan(ctx, struct{}{}, cb)
+}
+
+func (c *TypedCall[T]) Stats() Stats {
+	return c.group.Stats()
+}
+
+// Call and Group keep the original interface{} API on top of the typed
+// versions.
+type Result = TypedResult[interface{}]
+
+type Call struct {
+	call TypedCall[interface{}]
+}
+
+func (c *Call) Do(
+	ctx context.Context,
+	cb func(context.Context) (interface{}, error),
+) (interface{}, error) {
+	return c.call.Do(ctx, cb)
+}
+
+func (c *Call) DoChan(
+	ctx context.Context,
+	cb func(context.Context) (interface{}, error),
+) <-chan Result {
+	return c.call.DoChan(ctx, cb)
+}
+
+func (c *Call) Stats() Stats {
+	return c.call.Stats()
+}
+
+type Group struct {
+	group TypedGroup[string, interface{}]
+}
+
+func (g *Group) Do(
+	ctx context.Context,
+	key string,
+	cb func(context.Context) (interface{}, error),
+) (interface{}, error) {
+	return g.group.Do(ctx, key, cb)
+}
+
+func (g *Group) DoChan(
+	ctx context.Context,
+	key string,
+	cb func(context.Context) (interface{}, error),
+) <-chan Result {
+	return g.group.DoChan(ctx, key, cb)
+}
+
+func (g *Group) Stats() Stats {
+	return g.group.Stats()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingCall returns a callback that reports each start on started and
+// returns the worker's context error once it is cancelled, or v once release
+// is closed.
+func blockingCall(started chan<- struct{}, release <-chan struct{}, v int) func(context.Context) (int, error) {
+	return func(ctx context.Context) (int, error) {
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-release:
+			return v, nil
+		}
+	}
+}
+
+// waitForWaiting polls until n callers wait for the call in flight for key.
+func waitForWaiting[K comparable, T any](t *testing.T, g *TypedGroup[K, T], key K, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g.mu.Lock()
+		waiting := 0
+		if grp, ok := g.calls[key]; ok {
+			waiting = grp.waiting
+		}
+		g.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers waiting, want %d", waiting, n)
+		}
+		time.Sleep(time.Microsecond)
+	}
+}
+
+func TestCancelWhenAllWaitersLeave(t *testing.T) {
+	var g TypedGroup[string, int]
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	workerCtx := make(chan context.Context, 1)
+	cb := func(ctx context.Context) (int, error) {
+		workerCtx <- ctx
+		return blockingCall(started, release, 1)(ctx)
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	ch1 := g.DoChan(ctx1, "k", cb)
+	<-started
+	ch2 := g.DoChan(ctx2, "k", cb)
+	waitForWaiting(t, &g, "k", 2)
+
+	wctx := <-workerCtx
+	cancel1()
+	if r := <-ch1; r.Err != context.Canceled {
+		t.Fatalf("first caller got %v, want %v", r.Err, context.Canceled)
+	}
+	if wctx.Err() != nil {
+		t.Fatal("worker cancelled while a caller still waits")
+	}
+
+	cancel2()
+	if r := <-ch2; r.Err != context.Canceled {
+		t.Fatalf("second caller got %v, want %v", r.Err, context.Canceled)
+	}
+	select {
+	case <-wctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not cancelled after every caller left")
+	}
+
+	// The cancelled worker must not be joined by a new caller.
+	ch3 := g.DoChan(context.Background(), "k", cb)
+	<-started
+	close(release)
+	if r := <-ch3; r.Err != nil || r.Val != 1 || r.Shared {
+		t.Fatalf("caller after cancellation got %+v, want a fresh result 1", r)
+	}
+	if n := g.Stats().Executions; n != 2 {
+		t.Fatalf("%d executions, want 2", n)
+	}
+}
+
+func TestFinishedKeysRemoved(t *testing.T) {
+	var g TypedGroup[int, int]
+	for i := 0; i < 10; i++ {
+		if _, err := g.Do(context.Background(), i, func(context.Context) (int, error) {
+			return i, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The worker drops its key under the same lock that publishes the result,
+	// so it is gone by the time Do returns.
+	g.mu.Lock()
+	n := len(g.calls)
+	g.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("%d finished keys left in the group", n)
+	}
+}
+
+func TestDoChanSharedAndStats(t *testing.T) {
+	var g TypedGroup[string, int]
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	cb := blockingCall(started, release, 7)
+
+	first := g.DoChan(context.Background(), "k", cb)
+	<-started
+	var joined []<-chan TypedResult[int]
+	for i := 0; i < 2; i++ {
+		joined = append(joined, g.DoChan(context.Background(), "k", cb))
+	}
+	waitForWaiting(t, &g, "k", 3)
+	close(release)
+
+	if r := <-first; r.Val != 7 || r.Err != nil || r.Shared {
+		t.Fatalf("first caller got %+v, want 7 not shared", r)
+	}
+	for _, ch := range joined {
+		if r := <-ch; r.Val != 7 || r.Err != nil || !r.Shared {
+			t.Fatalf("joined caller got %+v, want 7 shared", r)
+		}
+	}
+
+	// A call after the first finished runs on its own.
+	if r := <-g.DoChan(context.Background(), "k", cb); r.Shared {
+		t.Fatalf("later caller got %+v, want not shared", r)
+	}
+	if st := g.Stats(); st.Executions != 2 || st.Served != 4 {
+		t.Fatalf("Executions %d, Served %d, want 2 and 4", st.Executions, st.Served)
+	}
+}
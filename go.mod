@@ -0,0 +1,3 @@
+module github.com/Feodosix/Go_examples
+
+go 1.21
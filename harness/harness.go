@@ -0,0 +1,316 @@
+// Package harness runs scripted goroutine interleavings against sync
+// primitives. Thread bodies only run while they hold the scheduler's token, and
+// the next thread to get it is picked by a seeded random source.
+//
+// Operations passed to Thread.Block, such as Lock or Wait, run without the
+// token, since they may park. After every step the scheduler waits until those
+// operations have settled: every blocked thread has either returned from its
+// operation or is parked in the runtime, which it reads from the goroutine
+// dump. Only then does it pick among the ready threads in id order, so a
+// failing seed replays the same sequence of steps, provided the primitive hands
+// off to its waiters in a fixed order, as channels do. Primitives that wake
+// several goroutines to race for one resource replay only approximately.
+//
+// An operation parked on a timer or on I/O looks settled too, so Block must
+// only be given operations that wait for other threads.
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Scenario builds fresh state for one run and returns the thread bodies.
+type Scenario func() []func(t *Thread)
+
+type eventKind int
+
+const (
+	evStart eventKind = iota
+	evYield
+	evBlock
+	evUnblock
+	evDone
+)
+
+type event struct {
+	t    *Thread
+	kind eventKind
+}
+
+type Thread struct {
+	id   int
+	gid  int64
+	s    *scheduler
+	wake chan struct{}
+}
+
+type scheduler struct {
+	rnd     *rand.Rand
+	events  chan event
+	timeout time.Duration
+	stack   []byte
+
+	mu      sync.Mutex
+	failure error
+}
+
+// Timeout is how long the scheduler waits for the running thread to hand the
+// token back before it gives up on the run.
+var Timeout = time.Second
+
+type Failure struct {
+	Seed int64
+	Err  error
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("seed %d: %v", f.Seed, f.Err)
+}
+
+// Run executes the scenario once with the given seed. Threads stuck when it
+// fails are abandoned.
+func Run(seed int64, sc Scenario) error {
+	s := &scheduler{
+		rnd:     rand.New(rand.NewSource(seed)),
+		events:  make(chan event),
+		timeout: Timeout,
+	}
+
+	bodies := sc()
+	for i, body := range bodies {
+		t := &Thread{id: i, s: s, wake: make(chan struct{})}
+		go t.run(body)
+	}
+
+	if err := s.loop(len(bodies)); err != nil {
+		return &Failure{Seed: seed, Err: err}
+	}
+	return nil
+}
+
+// Explore runs the scenario with seeds seed, seed+1, ... and returns the first
+// failure, which can be replayed with Run(f.Seed, sc).
+func Explore(seed int64, runs int, sc Scenario) error {
+	for i := 0; i < runs; i++ {
+		if err := Run(seed+int64(i), sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type runQueue struct {
+	ready   []*Thread
+	blocked map[*Thread]struct{}
+}
+
+func (q *runQueue) handle(ev event) {
+	switch ev.kind {
+	case evStart, evYield:
+		q.ready = append(q.ready, ev.t)
+	case evBlock:
+		q.blocked[ev.t] = struct{}{}
+	case evUnblock:
+		delete(q.blocked, ev.t)
+		q.ready = append(q.ready, ev.t)
+	}
+}
+
+func (s *scheduler) loop(live int) error {
+	q := &runQueue{blocked: make(map[*Thread]struct{})}
+	for started := 0; started < live; started++ {
+		q.handle(<-s.events)
+	}
+
+	for live > 0 {
+		if err := s.err(); err != nil {
+			return err
+		}
+
+		s.settle(q)
+		if len(q.ready) == 0 {
+			return fmt.Errorf("deadlock: %d threads blocked", len(q.blocked))
+		}
+
+		sort.Slice(q.ready, func(i, j int) bool { return q.ready[i].id < q.ready[j].id })
+		i := s.rnd.Intn(len(q.ready))
+		t := q.ready[i]
+		q.ready = append(q.ready[:i], q.ready[i+1:]...)
+		t.wake <- struct{}{}
+
+		// Wait for t to hand the token back. Operations released by t may
+		// return meanwhile.
+		for {
+			select {
+			case ev := <-s.events:
+				q.handle(ev)
+				if ev.t != t {
+					continue
+				}
+				if ev.kind == evDone {
+					live--
+				}
+			case <-time.After(s.timeout):
+				return fmt.Errorf("thread %d blocked outside Block for %v", t.id, s.timeout)
+			}
+			break
+		}
+	}
+	return s.err()
+}
+
+// settle collects unblock events until every blocked thread is parked inside
+// its operation. No thread holds the token while it runs, so nothing else can
+// wake them.
+func (s *scheduler) settle(q *runQueue) {
+	for {
+		for drained := false; !drained; {
+			select {
+			case ev := <-s.events:
+				q.handle(ev)
+			default:
+				drained = true
+			}
+		}
+		if len(q.blocked) == 0 {
+			return
+		}
+
+		states := s.goroutineStates()
+		parked := true
+		for t := range q.blocked {
+			if !isParked(states[t.gid]) {
+				parked = false
+				break
+			}
+		}
+		if parked {
+			// A thread parked on sending its unblock event is not done yet.
+			select {
+			case ev := <-s.events:
+				q.handle(ev)
+				continue
+			default:
+				return
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// goroutineStates maps goroutine ids to the state in their traceback header,
+// such as "chan receive" or "runnable".
+func (s *scheduler) goroutineStates() map[int64]string {
+	if s.stack == nil {
+		s.stack = make([]byte, 64<<10)
+	}
+	n := runtime.Stack(s.stack, true)
+	for n == len(s.stack) {
+		s.stack = make([]byte, 2*len(s.stack))
+		n = runtime.Stack(s.stack, true)
+	}
+
+	states := make(map[int64]string)
+	for _, line := range bytes.Split(s.stack[:n], []byte("\n")) {
+		if gid, state, ok := parseGoroutineHeader(line); ok {
+			states[gid] = state
+		}
+	}
+	return states
+}
+
+// parseGoroutineHeader parses "goroutine 7 [chan receive, 2 minutes]:".
+func parseGoroutineHeader(line []byte) (int64, string, bool) {
+	rest, ok := bytes.CutPrefix(line, []byte("goroutine "))
+	if !ok {
+		return 0, "", false
+	}
+	id, rest, ok := bytes.Cut(rest, []byte(" ["))
+	if !ok {
+		return 0, "", false
+	}
+	gid, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	state, _, _ := bytes.Cut(rest, []byte("]"))
+	state, _, _ = bytes.Cut(state, []byte(","))
+	return gid, string(state), true
+}
+
+func isParked(state string) bool {
+	switch state {
+	case "", "running", "runnable", "syscall", "copystack", "preempted":
+		return false
+	}
+	return true
+}
+
+func (s *scheduler) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failure
+}
+
+func (t *Thread) run(body func(t *Thread)) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.fail(fmt.Errorf("thread %d panicked: %v", t.id, r))
+		}
+		t.s.events <- event{t, evDone}
+	}()
+
+	t.gid = currentGoroutine()
+	t.s.events <- event{t, evStart}
+	<-t.wake
+	body(t)
+}
+
+func currentGoroutine() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	gid, _, _ := parseGoroutineHeader(buf[:n])
+	return gid
+}
+
+func (t *Thread) ID() int {
+	return t.id
+}
+
+// Yield hands the token back to the scheduler and waits to be picked again.
+func (t *Thread) Yield() {
+	t.s.events <- event{t, evYield}
+	<-t.wake
+}
+
+// Block hands the token back and runs op, which may block. The thread becomes
+// ready once op returns and waits to be picked again.
+func (t *Thread) Block(op func()) {
+	t.s.events <- event{t, evBlock}
+	op()
+	t.s.events <- event{t, evUnblock}
+	<-t.wake
+}
+
+// Check records a failure when ok is false. Only the first failure of a run is
+// kept.
+func (t *Thread) Check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		t.fail(fmt.Errorf("thread %d: "+format, append([]interface{}{t.id}, args...)...))
+	}
+}
+
+func (t *Thread) fail(err error) {
+	t.s.mu.Lock()
+	if t.s.failure == nil {
+		t.s.failure = err
+	}
+	t.s.mu.Unlock()
+}
@@ -0,0 +1,78 @@
+package harness
+
+import (
+	"fmt"
+	"testing"
+)
+
+// leakyCond is a FIFO condition variable that drops every third Signal.
+type leakyCond struct {
+	l       Locker
+	lock    *Mutex
+	waiters []chan struct{}
+	signals int
+}
+
+func newLeakyCond(l Locker) Cond {
+	return &leakyCond{l: l, lock: NewMutex()}
+}
+
+func (c *leakyCond) Wait() {
+	ch := make(chan struct{})
+	c.lock.Lock()
+	c.waiters = append(c.waiters, ch)
+	c.lock.Unlock()
+
+	c.l.Unlock()
+	<-ch
+	c.l.Lock()
+}
+
+func (c *leakyCond) Signal() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.signals++
+	if c.signals%3 == 0 || len(c.waiters) == 0 {
+		return
+	}
+	close(c.waiters[0])
+	c.waiters = c.waiters[1:]
+}
+
+func (c *leakyCond) Broadcast() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, ch := range c.waiters {
+		close(ch)
+	}
+	c.waiters = nil
+}
+
+func TestExploreFindsLostSignal(t *testing.T) {
+	sc := NoLostSignal(newLeakyCond, 4)
+	err := Explore(1, 50, sc)
+	f, ok := err.(*Failure)
+	if !ok {
+		t.Fatalf("Explore returned %v, want a *Failure", err)
+	}
+
+	if err := Run(f.Seed, sc); err == nil {
+		t.Fatalf("seed %d failed under Explore but passed on replay", f.Seed)
+	}
+}
+
+// TestRunReplaysSeed keeps the number of runs small: threads stuck in a failed
+// run are abandoned, and every later run reads their stacks.
+func TestRunReplaysSeed(t *testing.T) {
+	sc := NoLostSignal(newLeakyCond, 4)
+	for seed := int64(1); seed <= 5; seed++ {
+		want := fmt.Sprint(Run(seed, sc))
+		for i := 0; i < 5; i++ {
+			if got := fmt.Sprint(Run(seed, sc)); got != want {
+				t.Fatalf("seed %d: run %d returned %v, first run returned %v", seed, i, got, want)
+			}
+		}
+	}
+}
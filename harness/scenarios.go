@@ -0,0 +1,177 @@
+package harness
+
+type Locker interface {
+	Lock()
+	Unlock()
+}
+
+type RWLocker interface {
+	Locker
+	RLock()
+	RUnlock()
+}
+
+type Cond interface {
+	Wait()
+	Signal()
+	Broadcast()
+}
+
+type WaitGroup interface {
+	Add(delta int)
+	Done()
+	Wait()
+}
+
+// Mutex is a Locker built on a channel, which hands the lock to blocked Lock
+// calls in arrival order. With sync.Mutex a new Lock can barge ahead of a woken
+// waiter, which makes scenarios replay only approximately.
+type Mutex struct {
+	ch chan struct{}
+}
+
+func NewMutex() *Mutex {
+	m := &Mutex{ch: make(chan struct{}, 1)}
+	m.ch <- struct{}{}
+	return m
+}
+
+func (m *Mutex) Lock() {
+	<-m.ch
+}
+
+func (m *Mutex) Unlock() {
+	select {
+	case m.ch <- struct{}{}:
+	default:
+		panic("unlock of unlocked Mutex")
+	}
+}
+
+// MutualExclusion checks that at most one thread at a time is inside the
+// critical section guarded by the Locker.
+func MutualExclusion(newLocker func() Locker, threads, iters int) Scenario {
+	return func() []func(*Thread) {
+		l := newLocker()
+		holders := 0
+
+		bodies := make([]func(*Thread), threads)
+		for i := range bodies {
+			bodies[i] = func(t *Thread) {
+				for j := 0; j < iters; j++ {
+					t.Block(l.Lock)
+					holders++
+					t.Check(holders == 1, "%d holders inside the lock", holders)
+					t.Yield()
+					holders--
+					l.Unlock()
+					t.Yield()
+				}
+			}
+		}
+		return bodies
+	}
+}
+
+// ReadersWriters checks that a writer never shares the RWLocker with anybody.
+func ReadersWriters(newRW func() RWLocker, readers, writers, iters int) Scenario {
+	return func() []func(*Thread) {
+		rw := newRW()
+		activeReaders, activeWriters := 0, 0
+
+		var bodies []func(*Thread)
+		for i := 0; i < readers; i++ {
+			bodies = append(bodies, func(t *Thread) {
+				for j := 0; j < iters; j++ {
+					t.Block(rw.RLock)
+					activeReaders++
+					t.Check(activeWriters == 0, "reader inside with %d writers", activeWriters)
+					t.Yield()
+					activeReaders--
+					rw.RUnlock()
+				}
+			})
+		}
+		for i := 0; i < writers; i++ {
+			bodies = append(bodies, func(t *Thread) {
+				for j := 0; j < iters; j++ {
+					t.Block(rw.Lock)
+					activeWriters++
+					t.Check(activeWriters == 1 && activeReaders == 0,
+						"writer inside with %d writers and %d readers", activeWriters, activeReaders)
+					t.Yield()
+					activeWriters--
+					rw.Unlock()
+				}
+			})
+		}
+		return bodies
+	}
+}
+
+// NoLostSignal has one producer hand out items one Signal at a time. A lost
+// wakeup leaves a consumer parked forever and shows up as a deadlock.
+func NoLostSignal(newCond func(l Locker) Cond, consumers int) Scenario {
+	return func() []func(*Thread) {
+		mu := NewMutex()
+		c := newCond(mu)
+		items := 0
+
+		bodies := []func(*Thread){func(t *Thread) {
+			for i := 0; i < consumers; i++ {
+				t.Block(mu.Lock)
+				items++
+				c.Signal()
+				mu.Unlock()
+				t.Yield()
+			}
+		}}
+		for i := 0; i < consumers; i++ {
+			bodies = append(bodies, func(t *Thread) {
+				t.Block(mu.Lock)
+				for items == 0 {
+					t.Block(c.Wait)
+				}
+				items--
+				t.Check(items >= 0, "item count went negative: %d", items)
+				mu.Unlock()
+			})
+		}
+		return bodies
+	}
+}
+
+// WaitGroupCounter checks that Wait returns only after every worker called
+// Done, that a Wait on the drained group does not block, and that one more Done
+// takes the counter below zero and panics.
+func WaitGroupCounter(newWG func() WaitGroup, workers int) Scenario {
+	return func() []func(*Thread) {
+		wg := newWG()
+		pending := workers
+		wg.Add(workers)
+
+		bodies := []func(*Thread){func(t *Thread) {
+			t.Block(wg.Wait)
+			t.Check(pending == 0, "Wait returned with %d workers pending", pending)
+
+			t.Block(wg.Wait)
+			t.Check(panics(wg.Done), "Done on a drained WaitGroup did not panic")
+		}}
+		for i := 0; i < workers; i++ {
+			bodies = append(bodies, func(t *Thread) {
+				t.Yield()
+				wg.Done()
+				pending--
+			})
+		}
+		return bodies
+	}
+}
+
+func panics(f func()) (panicked bool) {
+	defer func() {
+		panicked = recover() != nil
+	}()
+	f()
+	return false
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Feodosix/Go_examples/harness"
+)
+
+// keyLocker adapts LockKeys to harness.Locker. Every Lock takes the same keys,
+// so the keys behave as one mutex.
+type keyLocker struct {
+	l      *KeyLock
+	keys   []string
+	unlock func()
+}
+
+func (k *keyLocker) Lock() {
+	_, k.unlock = k.l.LockKeys(k.keys, nil)
+}
+
+func (k *keyLocker) Unlock() {
+	k.unlock()
+}
+
+func TestMutualExclusion(t *testing.T) {
+	sc := harness.MutualExclusion(func() harness.Locker {
+		return &keyLocker{l: New(), keys: []string{"b", "a"}}
+	}, 3, 3)
+	if err := harness.Explore(1, 100, sc); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Feodosix/Go_examples/harness"
+)
+
+func TestMutualExclusion(t *testing.T) {
+	sc := harness.MutualExclusion(func() harness.Locker { return New() }, 3, 3)
+	if err := harness.Explore(1, 100, sc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadersWriters(t *testing.T) {
+	sc := harness.ReadersWriters(func() harness.RWLocker { return New() }, 3, 2, 3)
+	if err := harness.Explore(1, 100, sc); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Feodosix/Go_examples/harness"
+)
+
+func TestCounter(t *testing.T) {
+	sc := harness.WaitGroupCounter(func() harness.WaitGroup { return New() }, 4)
+	if err := harness.Explore(1, 100, sc); err != nil {
+		t.Fatal(err)
+	}
+}